@@ -0,0 +1,300 @@
+package trailbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+)
+
+// AdminRequiredError is returned by admin APIs, e.g. ListRecordApis, when the
+// client is not logged in as an admin.
+type AdminRequiredError struct {
+	*FetchError
+}
+
+func (e *AdminRequiredError) Error() string {
+	return fmt.Sprintf("AdminRequiredError(%s)", e.FetchError)
+}
+
+func (e *AdminRequiredError) Unwrap() error {
+	return e.FetchError
+}
+
+// asAdminRequiredError wraps 401 and 403 responses of admin APIs in an
+// AdminRequiredError and passes through all other errors.
+func asAdminRequiredError(err error) error {
+	var ferr *FetchError
+	if errors.As(err, &ferr) && (ferr.StatusCode == http.StatusUnauthorized || ferr.StatusCode == http.StatusForbidden) {
+		return &AdminRequiredError{FetchError: ferr}
+	}
+	return err
+}
+
+// Permission is an operation a record API may grant, see RecordApiInfo.
+type Permission int
+
+// Values match the server's PermissionFlag.
+const (
+	CreatePermission Permission = 1
+	ReadPermission   Permission = 2
+	UpdatePermission Permission = 4
+	DeletePermission Permission = 8
+	SchemaPermission Permission = 16
+)
+
+func (p Permission) String() string {
+	switch p {
+	case CreatePermission:
+		return "Create"
+	case ReadPermission:
+		return "Read"
+	case UpdatePermission:
+		return "Update"
+	case DeletePermission:
+		return "Delete"
+	case SchemaPermission:
+		return "Schema"
+	default:
+		return fmt.Sprintf("Permission(%d)", int(p))
+	}
+}
+
+// RecordApiInfo describes a record API configured on the server.
+type RecordApiInfo struct {
+	Name      string
+	TableName string
+	// Operations granted to anyone and to authenticated users, respectively.
+	// Access rules may further restrict them.
+	WorldPermissions         []Permission
+	AuthenticatedPermissions []Permission
+}
+
+// ListRecordApis returns the record APIs configured on the server, e.g. for
+// tooling to discover the available tables. The client must be logged in as
+// an admin, otherwise an AdminRequiredError is returned.
+func (c *Client) ListRecordApis(ctx context.Context) ([]RecordApiInfo, error) {
+	resp, err := c.Do(ctx, "GET", adminApi+"/config", nil, nil)
+	if err != nil {
+		return nil, asAdminRequiredError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecordApis(body)
+}
+
+// ServerInfo describes the server's build, see Client.ServerInfo.
+type ServerInfo struct {
+	// Version is the release the server was built from, e.g. "v0.12.0", or
+	// empty if unknown, e.g. for development builds.
+	Version string
+	// CommitsSinceVersion is the number of commits the build is ahead of
+	// Version.
+	CommitsSinceVersion int
+	CommitHash          string
+	CommitDate          string
+	StartTime           time.Time
+	// Postgres is set if the server runs in its experimental Postgres mode.
+	Postgres bool
+}
+
+// ServerInfo returns the server's version and build information, which is
+// cached after the first successful call. The server doesn't advertise
+// individual capabilities, i.e. feature detection has to be based on the
+// version. The client must be logged in as an admin, otherwise an
+// AdminRequiredError is returned.
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	c.serverInfoMutex.Lock()
+	info := c.serverInfo
+	c.serverInfoMutex.Unlock()
+	if info != nil {
+		return info, nil
+	}
+
+	// Not holding the lock while fetching, such that concurrent callers aren't
+	// held up by one another's slow or canceled requests.
+	info, err := c.fetchServerInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.serverInfoMutex.Lock()
+	defer c.serverInfoMutex.Unlock()
+	if c.serverInfo == nil {
+		c.serverInfo = info
+	}
+	return c.serverInfo, nil
+}
+
+func (c *Client) fetchServerInfo(ctx context.Context) (*ServerInfo, error) {
+	resp, err := c.Do(ctx, "GET", adminApi+"/info", nil, nil)
+	if err != nil {
+		return nil, asAdminRequiredError(err)
+	}
+	defer resp.Body.Close()
+
+	var infoResponse struct {
+		CommitHash *string `json:"commit_hash"`
+		CommitDate *string `json:"commit_date"`
+		// A (tag, commits since) tuple.
+		GitVersion []json.RawMessage `json:"git_version"`
+		StartTime  int64             `json:"start_time"`
+		Postgres   bool              `json:"postgres"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&infoResponse); err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{
+		StartTime: time.Unix(infoResponse.StartTime, 0),
+		Postgres:  infoResponse.Postgres,
+	}
+	if infoResponse.CommitHash != nil {
+		info.CommitHash = *infoResponse.CommitHash
+	}
+	if infoResponse.CommitDate != nil {
+		info.CommitDate = *infoResponse.CommitDate
+	}
+	if len(infoResponse.GitVersion) == 2 {
+		if err := json.Unmarshal(infoResponse.GitVersion[0], &info.Version); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(infoResponse.GitVersion[1], &info.CommitsSinceVersion); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// Field numbers of the server's GetConfigResponse, Config and RecordApiConfig
+// protobuf messages. The admin config is only served as protobuf. Rather than
+// depending on a protobuf library and generated code for a handful of fields,
+// the wire format is decoded by hand and all other fields are skipped.
+const (
+	getConfigResponseConfigField = 1
+	configRecordApisField        = 11
+	recordApiNameField           = 1
+	recordApiTableNameField      = 2
+	recordApiAclWorldField       = 7
+	recordApiAclAuthField        = 8
+)
+
+func decodeRecordApis(data []byte) ([]RecordApiInfo, error) {
+	var apis []RecordApiInfo
+	err := walkProtoFields(data, func(field int, wireType int, value []byte, varint uint64) error {
+		if field != getConfigResponseConfigField || wireType != protoBytes {
+			return nil
+		}
+		return walkProtoFields(value, func(field int, wireType int, value []byte, varint uint64) error {
+			if field != configRecordApisField || wireType != protoBytes {
+				return nil
+			}
+			api, err := decodeRecordApi(value)
+			if err != nil {
+				return err
+			}
+			apis = append(apis, api)
+			return nil
+		})
+	})
+	return apis, err
+}
+
+func decodeRecordApi(data []byte) (RecordApiInfo, error) {
+	var api RecordApiInfo
+	err := walkProtoFields(data, func(field int, wireType int, value []byte, varint uint64) error {
+		switch field {
+		case recordApiNameField:
+			api.Name = string(value)
+		case recordApiTableNameField:
+			api.TableName = string(value)
+		case recordApiAclWorldField, recordApiAclAuthField:
+			var permissions []Permission
+			switch wireType {
+			case protoVarint:
+				permissions = []Permission{Permission(varint)}
+			case protoBytes:
+				// Packed repeated field.
+				for len(value) > 0 {
+					v, n := binary.Uvarint(value)
+					if n <= 0 {
+						return errors.New("invalid packed permissions")
+					}
+					permissions = append(permissions, Permission(v))
+					value = value[n:]
+				}
+			}
+			if field == recordApiAclWorldField {
+				api.WorldPermissions = append(api.WorldPermissions, permissions...)
+			} else {
+				api.AuthenticatedPermissions = append(api.AuthenticatedPermissions, permissions...)
+			}
+		}
+		return nil
+	})
+	return api, err
+}
+
+// Protobuf wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// walkProtoFields calls visit for every field of the protobuf message data.
+// value is set for length-delimited fields and varint for varint fields.
+func walkProtoFields(data []byte, visit func(field int, wireType int, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid protobuf field key")
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), int(key&7)
+
+		var value []byte
+		var varint uint64
+		switch wireType {
+		case protoVarint:
+			varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			data = data[n:]
+		case protoFixed64, protoFixed32:
+			size := 8
+			if wireType == protoFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errors.New("truncated protobuf field")
+			}
+			data = data[size:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("truncated protobuf field")
+			}
+			value = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type: %d", wireType)
+		}
+
+		if err := visit(field, wireType, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
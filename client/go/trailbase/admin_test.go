@@ -0,0 +1,163 @@
+package trailbase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"encoding/binary"
+)
+
+func protoTag(field int, wireType int) []byte {
+	return binary.AppendUvarint(nil, uint64(field<<3|wireType))
+}
+
+func protoBytesField(field int, value []byte) []byte {
+	out := protoTag(field, protoBytes)
+	out = binary.AppendUvarint(out, uint64(len(value)))
+	return append(out, value...)
+}
+
+func protoVarintField(field int, value uint64) []byte {
+	return binary.AppendUvarint(protoTag(field, protoVarint), value)
+}
+
+func TestListRecordApisDecoding(t *testing.T) {
+	var movies []byte
+	movies = append(movies, protoBytesField(recordApiNameField, []byte("movies"))...)
+	movies = append(movies, protoBytesField(recordApiTableNameField, []byte("movies_table"))...)
+	movies = append(movies, protoVarintField(recordApiAclWorldField, uint64(ReadPermission))...)
+	// Unknown fields are skipped.
+	movies = append(movies, protoVarintField(9, 1)...)
+	movies = append(movies, append(protoTag(99, protoFixed32), 1, 2, 3, 4)...)
+	// Packed encoding.
+	movies = append(movies, protoBytesField(recordApiAclAuthField, []byte{byte(CreatePermission), byte(ReadPermission)})...)
+
+	var config []byte
+	config = append(config, protoBytesField(1, []byte("unrelated"))...)
+	config = append(config, protoBytesField(configRecordApisField, movies)...)
+	config = append(config, protoBytesField(configRecordApisField, protoBytesField(recordApiNameField, []byte("other")))...)
+
+	var response []byte
+	response = append(response, protoBytesField(getConfigResponseConfigField, config)...)
+	response = append(response, protoBytesField(2, []byte("hash"))...)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/_admin/config" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write(response)
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(time.Hour)))
+	assertFine(t, err)
+
+	apis, err := client.ListRecordApis(t.Context())
+	assertFine(t, err)
+	expected := []RecordApiInfo{
+		{
+			Name:                     "movies",
+			TableName:                "movies_table",
+			WorldPermissions:         []Permission{ReadPermission},
+			AuthenticatedPermissions: []Permission{CreatePermission, ReadPermission},
+		},
+		{Name: "other"},
+	}
+	assert(t, reflect.DeepEqual(expected, apis), "unexpected apis")
+
+	unauthenticated, err := NewClient(server.URL)
+	assertFine(t, err)
+	_, err = unauthenticated.ListRecordApis(t.Context())
+	var adminErr *AdminRequiredError
+	assert(t, errors.As(err, &adminErr), "expected AdminRequiredError")
+
+	_, err = decodeRecordApis(response[:len(response)-2])
+	assert(t, err != nil, "expected error for truncated response")
+}
+
+func TestServerInfo(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		requests++
+		w.Write([]byte(`{"compiler": "rustc", "commit_hash": "abc", "commit_date": "2025-01-01", "git_version": ["v0.12.0", 3], "threads": 8, "start_time": 1700000000, "postgres": false}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(time.Hour)))
+	assertFine(t, err)
+
+	for range 2 {
+		info, err := client.ServerInfo(t.Context())
+		assertFine(t, err)
+		expected := &ServerInfo{
+			Version:             "v0.12.0",
+			CommitsSinceVersion: 3,
+			CommitHash:          "abc",
+			CommitDate:          "2025-01-01",
+			StartTime:           time.Unix(1700000000, 0),
+		}
+		assert(t, reflect.DeepEqual(expected, info), "unexpected info")
+	}
+	assertEqual(t, 1, requests)
+
+	unauthenticated, err := NewClient(server.URL)
+	assertFine(t, err)
+	_, err = unauthenticated.ServerInfo(t.Context())
+	var adminErr *AdminRequiredError
+	assert(t, errors.As(err, &adminErr), "expected AdminRequiredError")
+}
+
+func TestServerInfoConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request hangs until released.
+		if requests.Add(1) == 1 {
+			<-release
+		}
+		w.Write([]byte(`{"git_version": ["v0.12.0", 0], "start_time": 1700000000}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(time.Hour)))
+	assertFine(t, err)
+
+	hanging, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.ServerInfo(hanging)
+		done <- err
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other callers aren't held up by the hanging request.
+	info, err := client.ServerInfo(t.Context())
+	assertFine(t, err)
+	assertEqual(t, "v0.12.0", info.Version)
+
+	cancel()
+	assert(t, errors.Is(<-done, context.Canceled), "expected canceled request")
+
+	_, err = client.ServerInfo(t.Context())
+	assertFine(t, err)
+	assertEqual(t, int64(2), requests.Load())
+}
@@ -3,16 +3,24 @@ package trailbase
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"crypto/ed25519"
 	"encoding/base64"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 )
 
@@ -29,6 +37,48 @@ func (e *FetchError) Error() string {
 	return fmt.Sprintf("FetchError(%d: %s)", e.StatusCode, e.Message)
 }
 
+// RateLimitError is returned when the server responds with 429 Too Many
+// Requests. RetryAfter is parsed from the Retry-After header and is zero if
+// the header is absent or malformed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+
+	*FetchError
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("RateLimitError(retry after %s, %s)", e.RetryAfter, e.FetchError)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.FetchError
+}
+
+// ErrClientClosed is returned for requests issued after Client.Close.
+var ErrClientClosed = errors.New("client closed")
+
+// ErrRequestBodyTooLarge is returned for requests exceeding the client's
+// WithMaxRequestBodySize.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// RefreshError is returned when refreshing the auth token fails, either
+// explicitly via Client.Refresh or proactively as part of another request.
+type RefreshError struct {
+	// SessionEnded is set if the server rejected the refresh token, e.g. because
+	// it was revoked. The client has been logged out and the user needs to
+	// re-authenticate. Otherwise, the failure may be transient.
+	SessionEnded bool
+	Err          error
+}
+
+func (e *RefreshError) Error() string {
+	return fmt.Sprintf("RefreshError(session ended: %t, %s)", e.SessionEnded, e.Err)
+}
+
+func (e *RefreshError) Unwrap() error {
+	return e.Err
+}
+
 type User struct {
 	Sub      string
 	Email    *string
@@ -41,6 +91,24 @@ type Tokens struct {
 	CsrfToken    *string `json:"csrf_token,omitempty"`
 }
 
+// String redacts the tokens, to not leak credentials when printed or logged.
+// JSON serialization is unaffected.
+func (t Tokens) String() string {
+	return fmt.Sprintf("Tokens{auth_token: %s, refresh_token: %s, csrf_token: %s}",
+		redact(&t.AuthToken), redact(t.RefreshToken), redact(t.CsrfToken))
+}
+
+func (t Tokens) GoString() string {
+	return t.String()
+}
+
+func redact(secret *string) string {
+	if secret == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("<redacted:len=%d>", len(*secret))
+}
+
 type MultiFactorAuthToken struct {
 	Token string `json:"mfa_token"`
 }
@@ -64,16 +132,51 @@ type Header struct {
 	value string
 }
 
+func NewHeader(key string, value string) Header {
+	return Header{key: key, value: value}
+}
+
+func (h Header) Key() string {
+	return h.key
+}
+
+func (h Header) Value() string {
+	return h.value
+}
+
 type QueryParam struct {
 	key   string
 	value string
 }
 
+func NewQueryParam(key string, value string) QueryParam {
+	return QueryParam{key: key, value: value}
+}
+
+func (p QueryParam) Key() string {
+	return p.key
+}
+
+func (p QueryParam) Value() string {
+	return p.value
+}
+
 type TokenState struct {
 	s       *state
 	headers []Header
 }
 
+func (s *TokenState) String() string {
+	if s == nil || s.s == nil {
+		return "TokenState{unauthenticated}"
+	}
+	return fmt.Sprintf("TokenState{sub: %q, exp: %d, tokens: %s}", s.s.claims.Sub, s.s.claims.Exp, s.s.tokens)
+}
+
+func (s *TokenState) GoString() string {
+	return s.String()
+}
+
 func NewTokenState(tokens *Tokens) (*TokenState, error) {
 	if tokens == nil {
 		return &TokenState{
@@ -96,11 +199,56 @@ func NewTokenState(tokens *Tokens) (*TokenState, error) {
 	}, nil
 }
 
-func NewClient(baseUrl string) (*Client, error) {
-	return NewClientWithTokens(baseUrl, nil)
+// NewClient creates a new, unauthenticated client. Any path component of
+// baseUrl, e.g. "https://example.com/trailbase", is preserved as a prefix to
+// all API paths, which allows for TrailBase being mounted behind a reverse
+// proxy.
+func NewClient(baseUrl string, opts ...ClientOption) (*Client, error) {
+	return NewClientWithTokens(baseUrl, nil, opts...)
+}
+
+// NewClientWithServiceToken creates a client authenticated by a static auth
+// token, e.g. one minted with `trail user mint-token` for backend-to-backend
+// integrations. Without a refresh token, the client never attempts to refresh,
+// i.e. requests fail with 401 once the token expires and a new one must be
+// provided.
+func NewClientWithServiceToken(baseUrl string, token string, opts ...ClientOption) (*Client, error) {
+	return NewClientWithTokens(baseUrl, &Tokens{AuthToken: token}, opts...)
+}
+
+// TokensFromCookies extracts the tokens of a browser session from the
+// server's "auth_token" and "refresh_token" cookies of an incoming request,
+// e.g. for a server-side rendered Go app acting on behalf of a user who logged
+// in through TrailBase's auth UI. The CSRF token is read from the auth token's
+// claims. It returns http.ErrNoCookie if the request carries no auth cookie.
+//
+// The returned tokens are meant for NewClientWithTokens, which sends them as
+// headers rather than cookies. Header-based auth is immune to CSRF, since
+// browsers never attach headers automatically, and is what non-browser
+// clients should use. Cookies are only needed by browsers themselves, where
+// they are protected by the SameSite policy. If the client refreshes the
+// tokens, Client.Tokens has the new ones to be set as cookies on the response.
+func TokensFromCookies(r *http.Request) (*Tokens, error) {
+	authCookie, err := r.Cookie("auth_token")
+	if err != nil {
+		return nil, err
+	}
+	claims, err := decodeJwtTokenClaims(authCookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := &Tokens{AuthToken: authCookie.Value}
+	if claims.CsrfToken != "" {
+		tokens.CsrfToken = &claims.CsrfToken
+	}
+	if refreshCookie, err := r.Cookie("refresh_token"); err == nil && refreshCookie.Value != "" {
+		tokens.RefreshToken = &refreshCookie.Value
+	}
+	return tokens, nil
 }
 
-func NewClientWithTokens(baseUrl string, tokens *Tokens) (*Client, error) {
+func NewClientWithTokens(baseUrl string, tokens *Tokens, opts ...ClientOption) (*Client, error) {
 	base, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
@@ -109,27 +257,213 @@ func NewClientWithTokens(baseUrl string, tokens *Tokens) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		client: &defaultTransport{
+
+	options := clientOptions{
+		refreshLeeway:      defaultRefreshLeeway,
+		authApiPath:        authApi,
+		recordApiPath:      recordApi,
+		transactionApiPath: transactionApi,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.httpClient != nil && (options.insecureSkipVerify || options.rootCAs != nil) {
+		return nil, errors.New("TLS options cannot be combined with WithHTTPClient, configure its transport instead")
+	}
+
+	transport := options.transport
+	var closeIdleConnections func()
+	if transport == nil {
+		httpClient := options.buildHttpClient()
+		// Only pools created here are closed by Close. WithHTTPClient's and
+		// http.DefaultTransport's may be shared.
+		if options.httpClient == nil && httpClient.Transport != nil {
+			closeIdleConnections = httpClient.CloseIdleConnections
+		}
+		transport = &defaultTransport{
 			base:   base,
-			client: &http.Client{},
-		},
-		tokenState: tokenState,
-		tokenMutex: &sync.Mutex{},
-	}, nil
+			client: httpClient,
+			dump:   options.requestDump,
+		}
+	}
+
+	codec := options.codec
+	if codec == nil {
+		codec = jsonCodec{}
+	}
+
+	client := &Client{
+		client:                 transport,
+		codec:                  codec,
+		timeout:                options.timeout,
+		metrics:                options.metrics,
+		debugLogger:            options.debugLogger,
+		refreshLeeway:          options.refreshLeeway,
+		clock:                  time.Now,
+		authConfigTTL:          options.authConfigTTL,
+		defaultHeaders:         options.defaultHeaders,
+		strictStructValidation: options.strictStructValidation,
+		maxPageLimit:           options.maxPageLimit,
+		maxRequestBodySize:     options.maxRequestBodySize,
+		authApiPath:            options.authApiPath,
+		recordApiPath:          options.recordApiPath,
+		transactionApiPath:     options.transactionApiPath,
+		tokenState:             tokenState,
+		tokenMutex:             &sync.Mutex{},
+		tokensChanged:          make(chan struct{}, 1),
+		closeIdleConnections:   closeIdleConnections,
+	}
+	if options.backgroundRefresh != nil {
+		ctx, cancel := context.WithCancel(options.backgroundRefresh)
+		client.stopBackgroundRefresh = cancel
+		go client.backgroundRefresh(ctx)
+	}
+	return client, nil
 }
 
 type Client struct {
-	client Transport
+	client  Transport
+	codec   Codec
+	timeout time.Duration
+	metrics MetricsObserver
+	// Logs every request if non-nil, see WithDebugLogger.
+	debugLogger *slog.Logger
+	// Sent with every request, see WithDefaultHeaders.
+	defaultHeaders []Header
+	// See WithStrictStructValidation.
+	strictStructValidation bool
+	// Caps list limits if non-zero, see WithMaxPageLimit.
+	maxPageLimit uint64
+	// Limits request bodies if non-zero, see WithMaxRequestBodySize.
+	maxRequestBodySize int
+	// Base paths of the versioned APIs, see e.g. WithAuthApiPath.
+	authApiPath        string
+	recordApiPath      string
+	transactionApiPath string
+
+	// Auth tokens are proactively refreshed this long before they expire.
+	refreshLeeway time.Duration
+	// Offset of the server's clock relative to ours in nanoseconds, learned from
+	// the Date header of responses.
+	clockOffset atomic.Int64
+	// Source of the current time for expiry checks, replaceable in tests.
+	clock func() time.Time
+
+	// The server's JWT public key, lazily fetched by VerifyJWT and cached for
+	// authConfigTTL, or forever if zero.
+	authConfigTTL    time.Duration
+	publicKey        ed25519.PublicKey
+	publicKeyFetched time.Time
+	publicKeyMutex   sync.Mutex
+
+	// Lazily fetched and cached by ServerInfo.
+	serverInfo      *ServerInfo
+	serverInfoMutex sync.Mutex
 
 	tokenState *TokenState
 	tokenMutex *sync.Mutex
+	// Signaled when tokenState changes, see backgroundRefresh.
+	tokensChanged chan struct{}
+	// Stops the background refresh, if any.
+	stopBackgroundRefresh context.CancelFunc
+	// Closes idle connections of a pool owned by this client, if any.
+	closeIdleConnections func()
+
+	closed atomic.Bool
+}
+
+// Close stops the background refresh started by WithBackgroundRefresh, if
+// any, and marks the client unusable: subsequent requests fail with
+// ErrClientClosed. Closing is optional for plain request/response usage, but
+// required to stop the background refresh unless its context is canceled
+// otherwise.
+//
+// Idle connections are only closed if the client created its own connection
+// pool, e.g. due to WithMaxIdleConns. Transports passed via WithTransport or
+// WithHTTPClient, as well as http.DefaultTransport, may be shared and are left
+// alone. Clones never close their parent's connections and remain usable,
+// since they are closed independently.
+func (c *Client) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	if c.stopBackgroundRefresh != nil {
+		c.stopBackgroundRefresh()
+	}
+	if c.closeIdleConnections != nil {
+		c.closeIdleConnections()
+	}
+	return nil
+}
+
+// String describes the client without revealing its credentials.
+func (c *Client) String() string {
+	c.tokenMutex.Lock()
+	tokenState := c.tokenState
+	c.tokenMutex.Unlock()
+	return fmt.Sprintf("Client{base_url: %s, token_state: %s}", c.BaseUrl(), tokenState)
+}
+
+func (c *Client) GoString() string {
+	return c.String()
+}
+
+// Clone returns an unauthenticated client sharing c's configuration and
+// transport, e.g. to cheaply derive per-user clients from a single base client
+// in a server. Token state is not shared, i.e. logging in or out on the clone
+// does not affect c and vice versa.
+func (c *Client) Clone() *Client {
+	clone := &Client{
+		client:                 c.client,
+		codec:                  c.codec,
+		timeout:                c.timeout,
+		metrics:                c.metrics,
+		debugLogger:            c.debugLogger,
+		refreshLeeway:          c.refreshLeeway,
+		clock:                  c.clock,
+		authConfigTTL:          c.authConfigTTL,
+		defaultHeaders:         c.defaultHeaders,
+		strictStructValidation: c.strictStructValidation,
+		maxPageLimit:           c.maxPageLimit,
+		maxRequestBodySize:     c.maxRequestBodySize,
+		authApiPath:            c.authApiPath,
+		recordApiPath:          c.recordApiPath,
+		transactionApiPath:     c.transactionApiPath,
+		tokenMutex:             &sync.Mutex{},
+		tokensChanged:          make(chan struct{}, 1),
+	}
+	clone.clockOffset.Store(c.clockOffset.Load())
+	// Cannot fail without tokens.
+	clone.tokenState, _ = NewTokenState(nil)
+	return clone
+}
+
+// CloneWithTokens is like Clone but authenticates the clone with tokens.
+func (c *Client) CloneWithTokens(tokens *Tokens) (*Client, error) {
+	clone := c.Clone()
+	if _, err := clone.updateTokens(tokens); err != nil {
+		return nil, err
+	}
+	return clone, nil
 }
 
 func (c *Client) BaseUrl() *url.URL {
 	return c.client.BaseUrl()
 }
 
+// RecordApiPath returns the base path of record APIs relative to the base URL,
+// see WithRecordApiPath.
+func (c *Client) RecordApiPath() string {
+	return c.recordApiPath
+}
+
+// URL returns the URL of the given path below the client's base URL, e.g.
+// URL("api", "custom") for a custom endpoint. Unlike hard-coded absolute
+// paths, this preserves any prefix the server is mounted under.
+func (c *Client) URL(pathSegments ...string) *url.URL {
+	return c.BaseUrl().JoinPath(pathSegments...)
+}
+
 func (c *Client) Tokens() *Tokens {
 	c.tokenMutex.Lock()
 	defer c.tokenMutex.Unlock()
@@ -139,6 +473,19 @@ func (c *Client) Tokens() *Tokens {
 	return nil
 }
 
+// TokenTimeToLive returns how long the current auth token remains valid,
+// accounting for clock skew between client and server, e.g. to refresh ahead
+// of a burst of work. The duration is negative if the token already expired.
+// It returns false if the client is unauthenticated.
+func (c *Client) TokenTimeToLive() (time.Duration, bool) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	if c.tokenState == nil || c.tokenState.s == nil {
+		return 0, false
+	}
+	return time.Unix(c.tokenState.s.claims.Exp, 0).Sub(c.serverNow()), true
+}
+
 func (c *Client) User() *User {
 	c.tokenMutex.Lock()
 	defer c.tokenMutex.Unlock()
@@ -167,7 +514,7 @@ func (c *Client) Login(emailOrUsername string, password string) (*MultiFactorAut
 		return nil, err
 	}
 
-	resp, err := c.do("POST", authApi+"/login", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/login", reqBody, nil)
 	if err != nil {
 		ferr, ok := err.(*FetchError)
 		if ok && ferr != nil && ferr.StatusCode == 403 {
@@ -182,6 +529,7 @@ func (c *Client) Login(emailOrUsername string, password string) (*MultiFactorAut
 
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -213,10 +561,11 @@ func (c *Client) LoginSecond(token *MultiFactorAuthToken, code string) error {
 		return err
 	}
 
-	resp, err := c.do("POST", authApi+"/login_mfa", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/login_mfa", reqBody, nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -248,13 +597,11 @@ func (c *Client) RequestOtp(emailOrUsername string) error {
 		return err
 	}
 
-	resp, err := c.do("POST", authApi+"/otp/request", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/otp/request", reqBody, nil)
 	if err != nil {
 		return err
 	}
-	_ = resp
-
-	return nil
+	return drainAndClose(resp.Body)
 }
 
 func (c *Client) LoginOtp(email string, code string) error {
@@ -271,10 +618,11 @@ func (c *Client) LoginOtp(email string, code string) error {
 		return err
 	}
 
-	resp, err := c.do("POST", authApi+"/otp/login", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/otp/login", reqBody, nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -299,10 +647,11 @@ func (c *Client) LoginAnonymously() error {
 		return err
 	}
 
-	resp, err := c.do("POST", authApi+"/login_anonymous", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/login_anonymous", reqBody, nil)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -319,8 +668,13 @@ func (c *Client) LoginAnonymously() error {
 	return nil
 }
 
+// Logout ends the current session, i.e. invalidates the client's refresh
+// token. Other sessions of the same user remain valid. See LogoutAll.
 func (c *Client) Logout() error {
-	url := c.BaseUrl().JoinPath(authApi, "logout").String()
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	url := c.URL(c.authApiPath, "logout").String()
 	r := c.getHeadersAndRefreshToken()
 	if r != nil {
 		type LogoutRequest struct {
@@ -334,21 +688,40 @@ func (c *Client) Logout() error {
 			return err
 		}
 
-		_, err = c.do("POST", authApi+"/logout", body, nil)
+		resp, err := c.do("POST", c.authApiPath+"/logout", body, nil)
 		if err != nil {
 			return err
 		}
+		drainAndClose(resp.Body)
 	} else {
-		_, err := c.client.Get(url)
+		resp, err := c.client.Get(url)
 		if err != nil {
 			return err
 		}
+		drainAndClose(resp.Body)
 	}
 
 	_, err := c.updateTokens(nil)
 	return err
 }
 
+// LogoutAll ends all of the current user's sessions, e.g. on other devices
+// after a password change, and logs out the client.
+func (c *Client) LogoutAll() error {
+	if c.User() == nil {
+		return errors.New("Unauthenticated")
+	}
+
+	resp, err := c.do("GET", c.authApiPath+"/logout", nil, nil)
+	if err != nil {
+		return err
+	}
+	drainAndClose(resp.Body)
+
+	_, err = c.updateTokens(nil)
+	return err
+}
+
 func (c *Client) PromoteAnonymous(password string, email *string, username *string) error {
 	type Request struct {
 		NewPassword string  `json:"new_password"`
@@ -365,91 +738,650 @@ func (c *Client) PromoteAnonymous(password string, email *string, username *stri
 		return err
 	}
 
-	_, err = c.do("POST", authApi+"/promote_anonymous", reqBody, nil)
+	resp, err := c.do("POST", c.authApiPath+"/promote_anonymous", reqBody, nil)
+	if err != nil {
+		return err
+	}
+	return drainAndClose(resp.Body)
+}
+
+// DeleteAccount irrevocably deletes the current user's account and all their
+// sessions. On success, the client is logged out.
+func (c *Client) DeleteAccount() error {
+	resp, err := c.do("DELETE", c.authApiPath+"/delete", nil, nil)
+	if err != nil {
+		return err
+	}
+	drainAndClose(resp.Body)
+
+	_, err = c.updateTokens(nil)
+	return err
+}
+
+// InvalidVerificationTokenError is returned by VerifyEmail when the server
+// rejects the token. The server doesn't distinguish malformed from expired
+// tokens, in either case a new verification email has to be requested. Tokens
+// of already verified emails are accepted again rather than rejected.
+type InvalidVerificationTokenError struct {
+	*FetchError
+}
+
+func (e *InvalidVerificationTokenError) Error() string {
+	return fmt.Sprintf("InvalidVerificationTokenError(%s)", e.FetchError)
+}
+
+func (e *InvalidVerificationTokenError) Unwrap() error {
+	return e.FetchError
+}
+
+// VerifyEmail confirms a user's email address with the token sent to them in
+// the verification email, e.g. to complete a sign-up. It doesn't require the
+// client to be logged in.
+func (c *Client) VerifyEmail(token string) error {
+	resp, err := c.do("GET", c.authApiPath+"/verify_email/confirm/"+escapePathSegment(token), nil, nil)
+	if err != nil {
+		var ferr *FetchError
+		if errors.As(err, &ferr) && (ferr.StatusCode == http.StatusBadRequest || ferr.StatusCode == http.StatusUnauthorized) {
+			return &InvalidVerificationTokenError{FetchError: ferr}
+		}
+		return err
+	}
+	return drainAndClose(resp.Body)
+}
+
+// ResendVerificationEmail requests a new verification email for the given
+// address, e.g. if the original one got lost. To not disclose which addresses
+// are registered, the server reports success regardless of whether a user with
+// that email exists. Requests for the same address are rate limited to one per
+// four hours, further attempts fail with a *RateLimitError.
+func (c *Client) ResendVerificationEmail(email string) error {
+	resp, err := c.do("GET", c.authApiPath+"/verify_email/trigger", nil, []QueryParam{{key: "email", value: email}})
+	if err != nil {
+		return err
+	}
+	return drainAndClose(resp.Body)
+}
+
+// AvatarUrl returns the URL of the current user's avatar.
+func (c *Client) AvatarUrl() (string, error) {
+	user := c.User()
+	if user == nil {
+		return "", errors.New("Unauthenticated")
+	}
+	return c.URL(c.authApiPath, "avatar", user.Sub).String(), nil
+}
+
+// Avatar fetches the current user's avatar. The caller must close the returned
+// reader.
+func (c *Client) Avatar() (io.ReadCloser, error) {
+	user := c.User()
+	if user == nil {
+		return nil, errors.New("Unauthenticated")
+	}
+
+	resp, err := c.do("GET", c.authApiPath+"/avatar/"+user.Sub, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// UploadAvatar sets the current user's avatar. The server only accepts
+// "image/png" and "image/jpeg" and rejects requests exceeding its request size
+// limit, 10MB by default, with a FetchError of status 413.
+func (c *Client) UploadAvatar(r io.Reader, contentType string) error {
+	var filename string
+	switch contentType {
+	case "image/png":
+		filename = "avatar.png"
+	case "image/jpeg":
+		filename = "avatar.jpg"
+	default:
+		return fmt.Errorf("unsupported avatar content type: %s", contentType)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	partHeader.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	headers := []Header{{key: "Content-Type", value: writer.FormDataContentType()}}
+	resp, err := c.doWithHeaders("POST", c.authApiPath+"/avatar", headers, body.Bytes(), nil)
 	if err != nil {
 		return err
 	}
+	return drainAndClose(resp.Body)
+}
 
+// DeleteAvatar removes the current user's avatar.
+func (c *Client) DeleteAvatar() error {
+	resp, err := c.do("DELETE", c.authApiPath+"/avatar", nil, nil)
+	if err != nil {
+		return err
+	}
+	return drainAndClose(resp.Body)
+}
+
+// Ping checks that the server is reachable and healthy. The request is
+// unauthenticated and cheap.
+func (c *Client) Ping() error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	ctx, cancel := c.newRequestContext()
+	defer cancel()
+
+	resp, err := c.client.Do(ctx, "GET", healthcheckApi, c.withDefaultHeaders(nil), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 || !strings.EqualFold(string(respBody), "ok") {
+		return &FetchError{StatusCode: resp.StatusCode, Message: string(respBody), URL: c.URL(healthcheckApi)}
+	}
 	return nil
 }
 
 func (c *Client) Refresh() error {
+	ctx, cancel := c.newRequestContext()
+	defer cancel()
+	return c.refresh(ctx)
+}
+
+func (c *Client) refresh(ctx context.Context) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
 	headerAndRefresh := c.getHeadersAndRefreshToken()
 	if headerAndRefresh == nil {
 		return errors.New("Unauthenticated")
 	}
 
-	newTokenState, err := doRefreshToken(c.client, headerAndRefresh.headers, headerAndRefresh.refreshToken)
+	newTokenState, err := doRefreshToken(ctx, c.client, c.authApiPath, c.withDefaultHeaders(headerAndRefresh.headers), headerAndRefresh.refreshToken)
 	if err != nil {
+		c.logoutIfSessionEnded(headerAndRefresh.refreshToken, err)
 		return err
 	}
 
+	c.replaceTokenState(headerAndRefresh.refreshToken, newTokenState)
+	return nil
+}
+
+// backgroundRefresh proactively refreshes the auth token ahead of the lazy
+// refresh in doWithContext until ctx is done, see WithBackgroundRefresh.
+func (c *Client) backgroundRefresh(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	// Attempts are spaced out to not spin on persistent errors or tokens that
+	// are due for a refresh right away, unless a new session was established
+	// in the meantime, i.e. the refresh token is neither the one last used
+	// nor the one that the last refresh resulted in, e.g. due to rotation.
+	var lastRefreshTokens [2]string
+	var lastAttempt time.Time
+	for {
+		wait, refreshToken, ok := c.untilBackgroundRefresh()
+		if !ok {
+			// Unauthenticated or no refresh token, idle until tokens change.
+			timer.Stop()
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.tokensChanged:
+				continue
+			}
+		}
+		if refreshToken == lastRefreshTokens[0] || refreshToken == lastRefreshTokens[1] {
+			wait = max(wait, backgroundRefreshRetryDelay-time.Since(lastAttempt))
+		}
+
+		timer.Reset(max(wait, 0))
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.tokensChanged:
+			continue
+		case <-timer.C:
+		}
+
+		// Session ended errors drop the tokens and thus idle above. Other errors
+		// are retried, with the lazy refresh remaining as a fallback.
+		lastAttempt = time.Now()
+		refreshCtx, cancel := c.newRequestContextFrom(ctx)
+		c.refresh(refreshCtx)
+		cancel()
+		_, newRefreshToken, _ := c.untilBackgroundRefresh()
+		lastRefreshTokens = [2]string{refreshToken, newRefreshToken}
+	}
+}
+
+// untilBackgroundRefresh returns the time until the next background refresh
+// is due, which is ahead of the lazy refresh to not race it, and the refresh
+// token to be used. It returns false if there is no refresh token.
+func (c *Client) untilBackgroundRefresh() (time.Duration, string, bool) {
 	c.tokenMutex.Lock()
 	defer c.tokenMutex.Unlock()
-	c.tokenState = newTokenState
 
-	return nil
+	s := c.tokenState
+	if s == nil || s.s == nil || s.s.tokens.RefreshToken == nil {
+		return 0, "", false
+	}
+	refreshAt := time.Unix(s.s.claims.Exp, 0).Add(-c.refreshLeeway - backgroundRefreshAhead)
+	return refreshAt.Sub(c.serverNow()), *s.s.tokens.RefreshToken, true
+}
+
+// notifyTokensChanged wakes up the background refresh, if any, to reschedule.
+func (c *Client) notifyTokensChanged() {
+	select {
+	case c.tokensChanged <- struct{}{}:
+	default:
+	}
+}
+
+// logoutIfSessionEnded drops the client's tokens if err indicates that the
+// refresh token is dead, so that subsequent requests don't keep trying to
+// refresh it.
+func (c *Client) logoutIfSessionEnded(refreshToken string, err error) {
+	var refreshErr *RefreshError
+	if errors.As(err, &refreshErr) && refreshErr.SessionEnded {
+		state, _ := NewTokenState(nil)
+		c.replaceTokenState(refreshToken, state)
+	}
+}
+
+// replaceTokenState installs the result of refreshing refreshToken. The
+// swap is skipped if the token state changed while the refresh was in flight,
+// e.g. due to a concurrent logout or login, which must not be undone by a
+// stale refresh.
+func (c *Client) replaceTokenState(refreshToken string, state *TokenState) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	current := c.tokenState
+	if current == nil || current.s == nil || current.s.tokens.RefreshToken == nil || *current.s.tokens.RefreshToken != refreshToken {
+		return
+	}
+	c.tokenState = state
+	c.notifyTokensChanged()
+}
+
+// Do issues an authenticated request to path relative to the base URL, e.g.
+// to call a custom endpoint. Like all other requests, the auth token is
+// refreshed if needed, including once after a 401 response, and responses
+// with status >= 400 are returned as *FetchError. The request is bound to ctx
+// as well as the client's timeout, if any. The caller must close the response
+// body.
+func (c *Client) Do(ctx context.Context, method string, path string, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	ctx, cancel := c.newRequestContextFrom(ctx)
+	resp, err := c.doWithContext(ctx, method, path, nil, body, queryParams)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Only release the context once the caller is done with the body.
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// Call is a JSON convenience wrapper around Do for custom endpoints, e.g.
+// ones implemented in JS/TS on the server. A non-nil body is encoded as the
+// request body and, if out is non-nil, the response body is decoded into it.
+// Both use the client's codec, see WithCodec.
+func (c *Client) Call(ctx context.Context, method string, path string, body any, out any) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = c.codec.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.Do(ctx, method, path, reqBody, nil)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return drainAndClose(resp.Body)
+	}
+	defer resp.Body.Close()
+	return decodeBody(c.codec, resp.Body, out)
 }
 
 func (c *Client) do(method string, path string, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	return c.doWithHeaders(method, path, nil, body, queryParams)
+}
+
+// doWithHeaders is like do but sends extraHeaders in addition to the auth
+// headers.
+func (c *Client) doWithHeaders(method string, path string, extraHeaders []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	ctx, cancel := c.newRequestContext()
+	resp, err := c.doWithContext(ctx, method, path, extraHeaders, body, queryParams)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Only release the context once the caller is done with the body.
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (c *Client) doWithContext(ctx context.Context, method string, path string, extraHeaders []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	resp, refreshToken, err := c.doOnce(ctx, method, path, extraHeaders, body, nil, queryParams)
+
+	// The server may reject an auth token the client still considers valid,
+	// e.g. after the token was revoked or the server's keys were rotated. Refresh
+	// and retry once in that case. Auth APIs are exempt, e.g. a failed login
+	// must not trigger a refresh.
+	if ferr, ok := err.(*FetchError); ok && ferr.StatusCode == http.StatusUnauthorized && refreshToken != nil && !strings.HasPrefix(path, c.authApiPath+"/") {
+		retry, refreshErr := c.refreshAfterUnauthorized(ctx, *refreshToken)
+		if refreshErr != nil {
+			return nil, refreshErr
+		}
+		if retry {
+			resp, _, err = c.doOnce(ctx, method, path, extraHeaders, body, nil, queryParams)
+		}
+	}
+	return resp, err
+}
+
+// doStreamWithContext is like doWithContext but sends body without buffering
+// it, if the transport supports it, see StreamingTransport. Since body can only
+// be read once, requests are not retried after a 401 response.
+func (c *Client) doStreamWithContext(ctx context.Context, method string, path string, extraHeaders []Header, body io.Reader, queryParams []QueryParam) (*http.Response, error) {
+	resp, _, err := c.doOnce(ctx, method, path, extraHeaders, nil, body, queryParams)
+	return resp, err
+}
+
+// refreshAfterUnauthorized refreshes the auth token after the server rejected
+// the one belonging to refreshToken, unless a concurrent refresh already
+// replaced it. It returns false if the request should not be retried since
+// the client was logged out in the meantime.
+func (c *Client) refreshAfterUnauthorized(ctx context.Context, refreshToken string) (bool, error) {
+	current := c.getHeadersAndRefreshToken()
+	if current == nil {
+		return false, nil
+	}
+	if current.refreshToken != refreshToken {
+		return true, nil
+	}
+
+	newTokenState, err := doRefreshToken(ctx, c.client, c.authApiPath, c.withDefaultHeaders(current.headers), refreshToken)
+	if err != nil {
+		c.logoutIfSessionEnded(refreshToken, err)
+		return false, err
+	}
+	c.replaceTokenState(refreshToken, newTokenState)
+	return true, nil
+}
+
+// doOnce issues a single request and additionally returns the refresh token
+// belonging to the auth token the request was sent with, if any. If stream is
+// non-nil, it is sent as the request's body instead of body.
+func (c *Client) doOnce(ctx context.Context, method string, path string, extraHeaders []Header, body []byte, stream io.Reader, queryParams []QueryParam) (*http.Response, *string, error) {
+	if c.closed.Load() {
+		return nil, nil, ErrClientClosed
+	}
+	if c.maxRequestBodySize > 0 && len(body) > c.maxRequestBodySize {
+		return nil, nil, fmt.Errorf("%w: %d bytes exceed the limit of %d", ErrRequestBodyTooLarge, len(body), c.maxRequestBodySize)
+	}
+	if c.maxRequestBodySize > 0 && stream != nil {
+		stream = &limitedBody{body: stream, remaining: c.maxRequestBodySize}
+	}
 	headers, refreshToken := c.getHeadersAndRefreshTokenIfExpired()
 	if refreshToken != nil {
-		newTokenState, err := doRefreshToken(c.client, headers, *refreshToken)
+		newTokenState, err := doRefreshToken(ctx, c.client, c.authApiPath, c.withDefaultHeaders(headers), *refreshToken)
 		if err != nil {
-			return nil, err
+			c.logoutIfSessionEnded(*refreshToken, err)
+			return nil, nil, err
 		}
 		headers = newTokenState.headers
-		c.tokenMutex.Lock()
-		defer c.tokenMutex.Unlock()
 
-		c.tokenState = newTokenState
+		c.replaceTokenState(*refreshToken, newTokenState)
+		refreshToken = newTokenState.s.tokens.RefreshToken
+	} else if current := c.getHeadersAndRefreshToken(); current != nil {
+		refreshToken = &current.refreshToken
 	}
 
-	resp, err := c.client.Do(method, path, headers, body, queryParams)
+	if len(extraHeaders) > 0 {
+		// Copy to not alias the shared token state's headers.
+		headers = append(append([]Header{}, headers...), extraHeaders...)
+	}
+	headers = c.withDefaultHeaders(headers)
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	bodySize := len(body)
+	if stream != nil {
+		// The size of streamed bodies is unknown up front.
+		bodySize = -1
+		resp, err = c.sendStream(ctx, method, path, headers, stream, queryParams)
+	} else {
+		resp, err = c.client.Do(ctx, method, path, headers, body, queryParams)
+	}
+	if c.metrics != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		c.metrics.ObserveRequest(method, path, status, time.Since(start))
+	}
+	if c.debugLogger != nil {
+		c.logRequest(ctx, method, path, headers, bodySize, queryParams, resp, err, time.Since(start))
+	}
 	if err != nil {
-		return nil, err
+		return nil, refreshToken, err
 	}
+	c.updateClockOffset(resp.Header.Get("Date"), c.clock())
 
 	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, err
+			return nil, refreshToken, err
 		}
-		return nil, &FetchError{StatusCode: resp.StatusCode, Message: string(respBody), URL: c.BaseUrl().JoinPath(path)}
+		ferr := &FetchError{StatusCode: resp.StatusCode, Message: string(respBody), URL: c.URL(path)}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, refreshToken, &RateLimitError{
+				RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), c.clock()),
+				FetchError: ferr,
+			}
+		}
+		return nil, refreshToken, ferr
 	}
 
-	return resp, nil
+	return resp, refreshToken, nil
 }
 
-func (c *Client) stream(method string, path string, body []byte, queryParams []QueryParam) (<-chan Event, func(), error) {
-	resp, err := c.do(method, path, body, queryParams)
+// sendStream sends body via the transport's DoStream or, for transports not
+// supporting streaming, reads it into memory first.
+func (c *Client) sendStream(ctx context.Context, method string, path string, headers []Header, body io.Reader, queryParams []QueryParam) (*http.Response, error) {
+	if transport, ok := c.client.(StreamingTransport); ok {
+		return transport.DoStream(ctx, method, path, headers, body, queryParams)
+	}
+	buffered, err := io.ReadAll(body)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return c.client.Do(ctx, method, path, headers, buffered, queryParams)
+}
 
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(sseSplitter)
+// limitedBody fails with ErrRequestBodyTooLarge once more than remaining bytes
+// are read from a streamed request body, see WithMaxRequestBodySize.
+type limitedBody struct {
+	body      io.Reader
+	remaining int
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.remaining -= n
+	if b.remaining < 0 {
+		return 0, ErrRequestBodyTooLarge
+	}
+	return n, err
+}
+
+// updateClockOffset derives the offset between the server's clock and ours
+// from a response's Date header. Since Date only has a resolution of seconds,
+// offsets within a second are treated as no skew.
+func (c *Client) updateClockOffset(date string, now time.Time) {
+	if date == "" {
+		return
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+
+	offset := serverTime.Sub(now)
+	if offset.Abs() <= time.Second {
+		offset = 0
+	}
+	c.clockOffset.Store(int64(offset))
+}
+
+// serverNow returns the current time adjusted to the server's clock, which is
+// what token expiry has to be evaluated against.
+func (c *Client) serverNow() time.Time {
+	return c.clock().Add(time.Duration(c.clockOffset.Load()))
+}
+
+// Initial delay before re-establishing a dropped subscription, which doubles
+// with every failed attempt, see WithReconnect.
+const initialReconnectBackoff = 100 * time.Millisecond
+
+// stream subscribes to the server-sent events at path. If maxBackoff is
+// positive, dropped connections are re-established, see WithReconnect.
+func (c *Client) stream(method string, path string, body []byte, queryParams []QueryParam, maxBackoff time.Duration) (<-chan Event, func(), error) {
+	// Subscriptions are long-lived and thus exempt from the request timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := c.doWithContext(ctx, method, path, nil, body, queryParams)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
 
 	stream := make(chan Event)
 
 	go func() {
 		defer close(stream)
 
-		for scanner.Scan() {
-			event, err := parseEvent(scanner.Bytes())
-			if err != nil {
+		initialBackoff := min(initialReconnectBackoff, maxBackoff)
+		backoff := initialBackoff
+		for {
+			received, err := readEvents(ctx, resp.Body, stream)
+			resp.Body.Close()
+			if err != nil || maxBackoff <= 0 || ctx.Err() != nil {
 				return
 			}
+			if received {
+				backoff = initialBackoff
+			}
 
-			if event != nil {
-				stream <- *event
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, maxBackoff)
+
+				resp, err = c.doWithContext(ctx, method, path, nil, body, queryParams)
+				if err == nil {
+					break
+				}
+				if !isTransientStreamError(err) {
+					return
+				}
 			}
 		}
 	}()
 
-	return stream, func() {
-		resp.Body.Close()
-	}, nil
+	return stream, cancel, nil
+}
+
+// readEvents forwards the events read from body to stream until the body
+// ends or ctx is done. It reports whether any events were received.
+func readEvents(ctx context.Context, body io.Reader, stream chan<- Event) (bool, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Split(sseSplitter)
+
+	received := false
+	for scanner.Scan() {
+		event, err := parseEvent(scanner.Bytes())
+		if err != nil {
+			return received, err
+		}
+
+		if event != nil {
+			select {
+			case stream <- *event:
+				received = true
+			case <-ctx.Done():
+				return received, nil
+			}
+		}
+	}
+	return received, nil
+}
+
+// isTransientStreamError reports whether re-establishing a subscription that
+// failed with err may succeed, e.g. after network errors or while the server
+// is restarting, as opposed to e.g. missing permissions.
+func isTransientStreamError(err error) bool {
+	if errors.Is(err, ErrClientClosed) {
+		return false
+	}
+	var ferr *FetchError
+	if errors.As(err, &ferr) {
+		return ferr.StatusCode >= 500 || ferr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// newRequestContext returns the context for a single, non-streaming request,
+// which is bounded by the client's timeout if one was configured.
+func (c *Client) newRequestContext() (context.Context, context.CancelFunc) {
+	return c.newRequestContextFrom(context.Background())
+}
+
+func (c *Client) newRequestContextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	return c.newRequestContextWithTimeout(parent, 0)
+}
+
+// newRequestContextWithTimeout is like newRequestContextFrom but a positive
+// timeout takes precedence over the client's.
+func (c *Client) newRequestContextWithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
 }
 
 func (c *Client) updateTokens(tokens *Tokens) (*Tokens, error) {
@@ -461,10 +1393,56 @@ func (c *Client) updateTokens(tokens *Tokens) (*Tokens, error) {
 	c.tokenMutex.Lock()
 	defer c.tokenMutex.Unlock()
 	c.tokenState = state
+	c.notifyTokensChanged()
 
 	return tokens, nil
 }
 
+// logRequest logs a completed request to the debug logger. Credential headers
+// are redacted.
+func (c *Client) logRequest(ctx context.Context, method string, path string, headers []Header, bodySize int, queryParams []QueryParam, resp *http.Response, err error, dur time.Duration) {
+	u := c.URL(path)
+	query := u.Query()
+	for _, p := range queryParams {
+		query.Add(p.key, p.value)
+	}
+	u.RawQuery = query.Encode()
+
+	headerAttrs := make([]any, 0, len(headers))
+	for _, h := range headers {
+		value := h.value
+		if slices.ContainsFunc(redactedHeaders, func(key string) bool { return strings.EqualFold(key, h.key) }) {
+			value = "<redacted>"
+		}
+		headerAttrs = append(headerAttrs, slog.String(h.key, value))
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("url", u.String()),
+		slog.Group("headers", headerAttrs...),
+		slog.Int("body_size", bodySize),
+		slog.Duration("latency", dur),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	c.debugLogger.LogAttrs(ctx, slog.LevelDebug, "trailbase request", attrs...)
+}
+
+// withDefaultHeaders prepends the client's default headers to headers. Later
+// headers take precedence, thus defaults cannot override the content type or
+// credentials.
+func (c *Client) withDefaultHeaders(headers []Header) []Header {
+	if len(c.defaultHeaders) == 0 {
+		return headers
+	}
+	return append(append([]Header{}, c.defaultHeaders...), headers...)
+}
+
 type HeadersAndRefreshToken struct {
 	headers      []Header
 	refreshToken string
@@ -489,8 +1467,7 @@ func (c *Client) getHeadersAndRefreshToken() *HeadersAndRefreshToken {
 
 func (c *Client) getHeadersAndRefreshTokenIfExpired() ([]Header, *string) {
 	shouldRefresh := func(exp int64) bool {
-		now := time.Now()
-		return exp-60 < now.Unix()
+		return time.Unix(exp, 0).Add(-c.refreshLeeway).Before(c.serverNow())
 	}
 
 	c.tokenMutex.Lock()
@@ -513,7 +1490,7 @@ func (c *Client) getHeadersAndRefreshTokenIfExpired() ([]Header, *string) {
 	return headers, refreshToken
 }
 
-func doRefreshToken(client Transport, headers []Header, refreshToken string) (*TokenState, error) {
+func doRefreshToken(ctx context.Context, client Transport, authPath string, headers []Header, refreshToken string) (*TokenState, error) {
 	type RefreshRequest struct {
 		RefreshToken string `json:"refresh_token"`
 	}
@@ -524,43 +1501,52 @@ func doRefreshToken(client Transport, headers []Header, refreshToken string) (*T
 		return nil, err
 	}
 
-	path := authApi + "/refresh"
-	resp, err := client.Do("POST", path, headers, reqBody, nil)
+	path := authPath + "/refresh"
+	resp, err := client.Do(ctx, "POST", path, headers, reqBody, nil)
 	if err != nil {
-		return nil, err
+		return nil, &RefreshError{Err: err}
 	}
+	defer resp.Body.Close()
 
 	switch resp.StatusCode {
-	case 401:
-		// Refresh token was rejected. There's no way to recover. Might as well log out.
-		return NewTokenState(nil)
 	case 200:
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, err
+			return nil, &RefreshError{Err: err}
 		}
 
 		type RefreshResponse struct {
 			AuthToken string  `json:"auth_token"`
 			CsrfToken *string `json:"csrf_token,omitempty"`
+			// Only present if the server rotates refresh tokens.
+			RefreshToken *string `json:"refresh_token,omitempty"`
 		}
 		var refreshResp RefreshResponse
 		err = json.Unmarshal(respBody, &refreshResp)
 		if err != nil {
-			return nil, err
+			return nil, &RefreshError{Err: err}
+		}
+
+		newRefreshToken := &refreshToken
+		if refreshResp.RefreshToken != nil && *refreshResp.RefreshToken != "" {
+			newRefreshToken = refreshResp.RefreshToken
 		}
 
 		return NewTokenState(&Tokens{
 			AuthToken:    refreshResp.AuthToken,
-			RefreshToken: &refreshToken,
+			RefreshToken: newRefreshToken,
 			CsrfToken:    refreshResp.CsrfToken,
 		})
 	default:
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, err
+			return nil, &RefreshError{Err: err}
+		}
+		return nil, &RefreshError{
+			// Refresh token was rejected. There's no way to recover.
+			SessionEnded: resp.StatusCode == http.StatusUnauthorized,
+			Err:          &FetchError{StatusCode: resp.StatusCode, Message: string(respBody), URL: client.BaseUrl().JoinPath(path)},
 		}
-		return nil, &FetchError{StatusCode: resp.StatusCode, Message: string(respBody), URL: client.BaseUrl().JoinPath(path)}
 	}
 }
 
@@ -610,6 +1596,21 @@ func buildHeaders(tokens *Tokens) []Header {
 	return headers
 }
 
+// parseRetryAfter parses a Retry-After header value given either in seconds
+// or as an HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
 func sseSplitter(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -628,4 +1629,7 @@ func sseSplitter(data []byte, atEOF bool) (advance int, token []byte, err error)
 
 var jsonHeader Header = Header{key: "Content-Type", value: "application/json"}
 
-const authApi string = "api/auth/v1"
+const (
+	authApi        string = "api/auth/v1"
+	healthcheckApi string = "api/healthcheck"
+)
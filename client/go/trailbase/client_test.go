@@ -1,15 +1,22 @@
 package trailbase
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -152,6 +159,16 @@ func TestAuth(t *testing.T) {
 	assert(t, client.User() == nil, "should be nil")
 }
 
+func TestPing(t *testing.T) {
+	client, err := NewClient(SITE)
+	assertFine(t, err)
+	assertFine(t, client.Ping())
+
+	unreachable, err := NewClient("http://127.0.0.1:1")
+	assertFine(t, err)
+	assert(t, unreachable.Ping() != nil, "expected error")
+}
+
 func TestAnonymousAuth(t *testing.T) {
 	client, err := NewClient(SITE)
 	assertFine(t, err)
@@ -173,6 +190,27 @@ func TestAnonymousAuth(t *testing.T) {
 	err = client.Logout()
 }
 
+func TestDeleteAccount(t *testing.T) {
+	client, err := NewClient(SITE)
+	assertFine(t, err)
+
+	assertFine(t, client.LoginAnonymously())
+	tokens := client.Tokens()
+	assert(t, tokens != nil, "expected tokens")
+
+	assertFine(t, client.DeleteAccount())
+	assert(t, client.User() == nil, "should be nil")
+	assert(t, client.Tokens() == nil, "should be nil")
+
+	// The deleted user's session must not be usable anymore.
+	stale, err := NewClientWithTokens(SITE, tokens)
+	assertFine(t, err)
+	err = stale.Refresh()
+	var refreshErr *RefreshError
+	assert(t, errors.As(err, &refreshErr) && refreshErr.SessionEnded, fmt.Sprint("expected session to have ended: ", err))
+	assert(t, stale.Tokens() == nil, "expected logout")
+}
+
 func TestMultiFactorAuth(t *testing.T) {
 	client, err := NewClient(SITE)
 	if err != nil {
@@ -211,6 +249,35 @@ func TestOtpLogin(t *testing.T) {
 	}
 }
 
+func TestAvatar(t *testing.T) {
+	client := connect(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	assertFine(t, png.Encode(&buf, img))
+	expected := buf.Bytes()
+
+	err := client.UploadAvatar(bytes.NewReader(expected), "image/gif")
+	assert(t, err != nil, "expected unsupported content type")
+
+	assertFine(t, client.UploadAvatar(bytes.NewReader(expected), "image/png"))
+
+	avatar, err := client.Avatar()
+	assertFine(t, err)
+	got, err := io.ReadAll(avatar)
+	assertFine(t, err)
+	avatar.Close()
+	assert(t, bytes.Equal(expected, got), "avatar mismatch")
+
+	avatarUrl, err := client.AvatarUrl()
+	assertFine(t, err)
+	assert(t, strings.HasSuffix(avatarUrl, "/api/auth/v1/avatar/"+client.User().Sub), avatarUrl)
+
+	assertFine(t, client.DeleteAvatar())
+	_, err = client.Avatar()
+	assert(t, err != nil, "expected missing avatar")
+}
+
 type SimpleStrict struct {
 	Id *string `json:"id,omitempty"`
 
@@ -243,6 +310,14 @@ func TestRecordApi(t *testing.T) {
 	assertFine(t, err)
 	assertEqual(t, messages[0], simpleStrict0.TextNotNull)
 
+	// Read dynamically
+	{
+		dynamicApi := NewDynamicRecordApi(client, "simple_strict_table")
+		record, err := dynamicApi.Read(ids[0])
+		assertFine(t, err)
+		assertEqual[any](t, messages[0], (*record)["text_not_null"])
+	}
+
 	// List specific message
 	{
 		filters := []Filter{
@@ -267,6 +342,30 @@ func TestRecordApi(t *testing.T) {
 		assert(t, len(second.Records) == 0, fmt.Sprint("expected 0, got ", second))
 	}
 
+	// List either message using a top-level OR.
+	{
+		list, err := api.List(&ListArguments{
+			Filters: []Filter{
+				Or(
+					FilterColumn{Column: "text_not_null", Value: messages[0]},
+					FilterColumn{Column: "text_not_null", Value: messages[1]},
+				),
+			},
+		})
+		assertFine(t, err)
+		assertEqual(t, 2, len(list.Records))
+	}
+
+	// Limits beyond the server's hard limit are rejected rather than capped.
+	{
+		limit := uint64(100000)
+		_, err := api.List(&ListArguments{
+			Pagination: Pagination{Limit: &limit},
+		})
+		var ferr *FetchError
+		assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusBadRequest, fmt.Sprint("expected 400, got ", err))
+	}
+
 	// List all messages
 	{
 		filters := []Filter{
@@ -318,6 +417,105 @@ func TestRecordApi(t *testing.T) {
 	assert(t, r == nil, "expected nil value reading delete record")
 }
 
+func TestRecordApiFilterEncoding(t *testing.T) {
+	client := connect(t)
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	message := fmt.Sprintf("go client encoding test: a=b?c&d%%e+f [g] #h %d", time.Now().UnixNano())
+	id, err := api.Create(SimpleStrict{
+		TextNotNull: message,
+	})
+	assertFine(t, err)
+	defer api.Delete(id)
+
+	list, err := api.List(&ListArguments{
+		Filters: []Filter{
+			FilterColumn{Column: "text_not_null", Op: Equal, Value: message},
+		},
+	})
+	assertFine(t, err)
+	assertEqual(t, 1, len(list.Records))
+	assertEqual(t, message, list.Records[0].TextNotNull)
+}
+
+func TestListRecordApis(t *testing.T) {
+	client := connect(t)
+
+	apis, err := client.ListRecordApis(t.Context())
+	assertFine(t, err)
+
+	byName := map[string]RecordApiInfo{}
+	for _, api := range apis {
+		byName[api.Name] = api
+	}
+	simple := byName["simple_strict_table"]
+	assertEqual(t, "simple_strict_table", simple.TableName)
+	assertEqual(t, 4, len(simple.AuthenticatedPermissions))
+	movies := byName["movies"]
+	assertEqual(t, 1, len(movies.WorldPermissions))
+	assertEqual(t, ReadPermission, movies.WorldPermissions[0])
+
+	unauthenticated, err := NewClient(SITE)
+	assertFine(t, err)
+	_, err = unauthenticated.ListRecordApis(t.Context())
+	var adminErr *AdminRequiredError
+	assert(t, errors.As(err, &adminErr), fmt.Sprint("expected AdminRequiredError, got: ", err))
+}
+
+func TestCall(t *testing.T) {
+	client := connect(t)
+
+	// Served by the test fixture's Wasm guest.
+	var out struct {
+		Int int    `json:"int"`
+		Msg string `json:"msg"`
+		Obj struct {
+			Nested bool `json:"nested"`
+		} `json:"obj"`
+	}
+	assertFine(t, client.Call(t.Context(), "GET", "json", nil, &out))
+	assertEqual(t, 5, out.Int)
+	assertEqual(t, "foo", out.Msg)
+	assert(t, out.Obj.Nested, "expected nested")
+
+	err := client.Call(t.Context(), "GET", "error", nil, nil)
+	var ferr *FetchError
+	assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusTeapot, fmt.Sprint("expected 418, got: ", err))
+}
+
+func TestTransaction(t *testing.T) {
+	client := connect(t)
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	now := time.Now().Unix()
+	batch := client.Transaction()
+	batch.Api("simple_strict_table").
+		Create(SimpleStrict{TextNotNull: fmt.Sprint("go transaction test 0: ", now)}).
+		Create(SimpleStrict{TextNotNull: fmt.Sprint("go transaction test 1: ", now)})
+
+	ids, err := batch.Send()
+	assertFine(t, err)
+	assertEqual(t, 2, len(ids))
+
+	record, err := api.Read(ids[1])
+	assertFine(t, err)
+	assertEqual(t, fmt.Sprint("go transaction test 1: ", now), record.TextNotNull)
+
+	batch = client.Transaction()
+	batch.Api("simple_strict_table").
+		Update(ids[0], SimpleStrict{TextNotNull: fmt.Sprint("go transaction updated: ", now)}).
+		Delete(ids[1])
+	_, err = batch.Send()
+	assertFine(t, err)
+
+	record, err = api.Read(ids[0])
+	assertFine(t, err)
+	assertEqual(t, fmt.Sprint("go transaction updated: ", now), record.TextNotNull)
+
+	_, err = api.Read(ids[1])
+	assert(t, err != nil, "expected deleted record")
+}
+
 func TestRecordApiSubscriptions(t *testing.T) {
 	client := connect(t)
 	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
@@ -392,6 +590,194 @@ func TestRecordApiSubscriptions(t *testing.T) {
 	assertIs[*DeleteEvent](t, filteredEvents[1].Value)
 }
 
+// newTestTokens returns tokens with an unsigned auth token expiring at exp.
+func newTestTokens(exp time.Time) *Tokens {
+	claims := fmt.Sprintf(`{"sub":"test","iat":0,"exp":%d,"csrf_token":"csrf"}`, exp.Unix())
+	refreshToken := "refresh"
+	return &Tokens{
+		AuthToken:    "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature",
+		RefreshToken: &refreshToken,
+	}
+}
+
+func TestTokenTimeToLive(t *testing.T) {
+	unauthenticated, err := NewClient("http://127.0.0.1:1")
+	assertFine(t, err)
+	_, ok := unauthenticated.TokenTimeToLive()
+	assert(t, !ok, "expected no TTL without tokens")
+
+	now := time.Unix(1_700_000_000, 0)
+	client, err := NewClientWithTokens("http://127.0.0.1:1", newTestTokens(now.Add(90*time.Second)))
+	assertFine(t, err)
+	client.clock = func() time.Time { return now }
+
+	ttl, ok := client.TokenTimeToLive()
+	assert(t, ok, "expected TTL")
+	assertEqual(t, 90*time.Second, ttl)
+
+	// Server clock is a minute ahead of ours.
+	client.clockOffset.Store(int64(time.Minute))
+	ttl, _ = client.TokenTimeToLive()
+	assertEqual(t, 30*time.Second, ttl)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth/v1/verify_email/confirm/valid":
+			w.Write([]byte("email verified"))
+		case "/api/auth/v1/verify_email/confirm/unknown-user":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "invalid token", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+
+	assertFine(t, client.VerifyEmail("valid"))
+	for _, token := range []string{"expired", "unknown-user"} {
+		err = client.VerifyEmail(token)
+		var tokenErr *InvalidVerificationTokenError
+		assert(t, errors.As(err, &tokenErr), fmt.Sprint("expected InvalidVerificationTokenError, got: ", err))
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	var emails []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/auth/v1/verify_email/trigger" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		email := r.URL.Query().Get("email")
+		if slices.Contains(emails, email) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		emails = append(emails, email)
+		w.Write([]byte("Verification email sent"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+
+	assertFine(t, client.ResendVerificationEmail("user+tag@test.org"))
+	assertEqual(t, "user+tag@test.org", emails[0])
+
+	err = client.ResendVerificationEmail("user+tag@test.org")
+	var rateErr *RateLimitError
+	assert(t, errors.As(err, &rateErr) && rateErr.RetryAfter == time.Minute, fmt.Sprint("expected RateLimitError, got: ", err))
+}
+
+func TestTokensFromCookies(t *testing.T) {
+	session := newTestTokens(time.Now().Add(time.Hour))
+
+	var csrfHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csrfHeaders = append(csrfHeaders, r.Header.Get("CSRF-Token"))
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer server.Close()
+
+	req := httptest.NewRequest("GET", "/page", nil)
+	_, err := TokensFromCookies(req)
+	assert(t, errors.Is(err, http.ErrNoCookie), fmt.Sprint("expected ErrNoCookie, got: ", err))
+
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: session.AuthToken})
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: *session.RefreshToken})
+	tokens, err := TokensFromCookies(req)
+	assertFine(t, err)
+	assertEqual(t, session.AuthToken, tokens.AuthToken)
+	assertEqual(t, *session.RefreshToken, *tokens.RefreshToken)
+	assertEqual(t, "csrf", *tokens.CsrfToken)
+
+	client, err := NewClientWithTokens(server.URL, tokens)
+	assertFine(t, err)
+	err = NewRecordApi[SimpleStrict](client, "simple_strict_table").Update(StringRecordId("abc"), SimpleStrict{TextNotNull: "test"})
+	assertFine(t, err)
+	assertEqual(t, "csrf", strings.Join(csrfHeaders, ","))
+}
+
+func TestTokensRedacted(t *testing.T) {
+	tokens := newTestTokens(time.Now().Add(time.Hour))
+	refreshToken := "secret-refresh-token"
+	tokens.RefreshToken = &refreshToken
+
+	client, err := NewClientWithTokens("http://127.0.0.1:1", tokens)
+	assertFine(t, err)
+
+	for _, v := range []any{*tokens, tokens, client, client.tokenState} {
+		for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+			out := fmt.Sprintf(format, v)
+			assert(t, !strings.Contains(out, tokens.AuthToken) && !strings.Contains(out, refreshToken), "leaked token: "+out)
+			assert(t, strings.Contains(out, fmt.Sprintf("<redacted:len=%d>", len(tokens.AuthToken))), "expected redaction: "+out)
+		}
+	}
+
+	encoded, err := json.Marshal(tokens)
+	assertFine(t, err)
+	assert(t, strings.Contains(string(encoded), tokens.AuthToken), "expected token in JSON")
+}
+
+func TestRefreshLeeway(t *testing.T) {
+	tokens := newTestTokens(time.Now().Add(2 * time.Minute))
+
+	tests := []struct {
+		opts          []ClientOption
+		shouldRefresh bool
+	}{
+		{nil, false},
+		{[]ClientOption{WithRefreshLeeway(time.Minute)}, false},
+		{[]ClientOption{WithRefreshLeeway(5 * time.Minute)}, true},
+		{[]ClientOption{WithRefreshLeeway(0)}, false},
+	}
+
+	for i, test := range tests {
+		client, err := NewClientWithTokens("http://127.0.0.1:1", tokens, test.opts...)
+		assertFine(t, err)
+
+		_, refreshToken := client.getHeadersAndRefreshTokenIfExpired()
+		assert(t, (refreshToken != nil) == test.shouldRefresh, fmt.Sprint("unexpected refresh for case ", i))
+	}
+
+	expired, err := NewClientWithTokens("http://127.0.0.1:1", newTestTokens(time.Now().Add(-time.Second)), WithRefreshLeeway(0))
+	assertFine(t, err)
+	_, refreshToken := expired.getHeadersAndRefreshTokenIfExpired()
+	assert(t, refreshToken != nil, "expected refresh of expired token")
+}
+
+func TestRefreshTiming(t *testing.T) {
+	exp := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	client, err := NewClientWithTokens("http://127.0.0.1:1", newTestTokens(exp), WithRefreshLeeway(time.Minute))
+	assertFine(t, err)
+
+	now := exp.Add(-time.Hour)
+	client.clock = func() time.Time { return now }
+
+	shouldRefresh := func() bool {
+		_, refreshToken := client.getHeadersAndRefreshTokenIfExpired()
+		return refreshToken != nil
+	}
+
+	assert(t, !shouldRefresh(), "unexpected refresh an hour before expiry")
+	now = exp.Add(-time.Minute)
+	assert(t, !shouldRefresh(), "unexpected refresh exactly at the leeway boundary")
+	now = exp.Add(-time.Minute + time.Nanosecond)
+	assert(t, shouldRefresh(), "expected refresh within the leeway")
+
+	// The server's clock is 30s ahead, moving the refresh earlier.
+	client.clockOffset.Store(int64(30 * time.Second))
+	now = exp.Add(-90 * time.Second)
+	assert(t, !shouldRefresh(), "unexpected refresh at the skewed leeway boundary")
+	now = exp.Add(-90*time.Second + time.Nanosecond)
+	assert(t, shouldRefresh(), "expected refresh within the skewed leeway")
+}
+
 func assertEqual[T comparable](t *testing.T, expected T, got T) {
 	if expected != got {
 		buf := make([]byte, 1<<16)
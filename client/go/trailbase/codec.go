@@ -0,0 +1,55 @@
+package trailbase
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"encoding/json"
+)
+
+// Codec (de)serializes records and API payloads, see WithCodec.
+//
+// Unmarshal must not retain data after returning, since it may be backed by a
+// reused buffer.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// jsonCodec is the default Codec backed by encoding/json.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// Buffers exceeding this size are dropped rather than pooled to not pin large
+// amounts of memory after a single large response.
+const maxPooledBufferSize = 1 << 20
+
+// decodeBody reads body into a pooled buffer and decodes it into v.
+func decodeBody(codec Codec, body io.Reader, v any) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}
+	}()
+
+	if _, err := buf.ReadFrom(body); err != nil {
+		return err
+	}
+	return codec.Unmarshal(buf.Bytes(), v)
+}
@@ -2,10 +2,14 @@ package trailbase
 
 import (
 	"bytes"
+	"fmt"
 
 	"encoding/json"
 )
 
+// ValueEvent is implemented by events carrying a record's column values.
+// Numbers are decoded as json.Number rather than float64 to preserve large
+// integers, use its Int64 or Float64 methods to convert them.
 type ValueEvent interface {
 	Value() *map[string]any
 }
@@ -14,6 +18,7 @@ type InsertEvent struct {
 	value map[string]any
 }
 
+// Value returns the inserted record. Numbers are json.Numbers, see ValueEvent.
 func (ev *InsertEvent) Value() *map[string]any {
 	return &ev.value
 }
@@ -22,6 +27,7 @@ type UpdateEvent struct {
 	value map[string]any
 }
 
+// Value returns the updated record. Numbers are json.Numbers, see ValueEvent.
 func (ev *UpdateEvent) Value() *map[string]any {
 	return &ev.value
 }
@@ -30,6 +36,7 @@ type DeleteEvent struct {
 	value map[string]any
 }
 
+// Value returns the deleted record. Numbers are json.Numbers, see ValueEvent.
 func (ev *DeleteEvent) Value() *map[string]any {
 	return &ev.value
 }
@@ -39,6 +46,13 @@ type ErrorEvent struct {
 	Message *string
 }
 
+func (e *ErrorEvent) Error() string {
+	if e.Message != nil {
+		return fmt.Sprintf("subscription error %d: %s", e.Status, *e.Message)
+	}
+	return fmt.Sprintf("subscription error %d", e.Status)
+}
+
 type Event struct {
 	Seq   *int64
 	Value ValueEvent
@@ -50,27 +64,39 @@ func parseEvent(msg []byte) (*Event, error) {
 		return nil, nil
 	}
 
+	// Decode numbers as json.Number to not lose precision on large integers,
+	// e.g. 64-bit ids, which float64 cannot represent exactly.
+	decoder := json.NewDecoder(bytes.NewReader(msg[6:]))
+	decoder.UseNumber()
+
 	var evMap map[string]any
-	err := json.Unmarshal(msg[6:], &evMap)
+	err := decoder.Decode(&evMap)
 	if err != nil {
 		return nil, err
 	}
 
 	var seq *int64 = nil
-	seqf, ok := evMap["seq"].(float64)
-	if ok {
-		seqi := int64(seqf)
+	if seqn, ok := evMap["seq"].(json.Number); ok {
+		seqi, err := seqn.Int64()
+		if err != nil {
+			return nil, err
+		}
 		seq = &seqi
 	}
 
 	if val, ok := evMap["Error"]; ok {
 		var errObj = val.(map[string]any)
+		status, err := errObj["status"].(json.Number).Int64()
+		if err != nil {
+			return nil, err
+		}
+
 		var msg, ok = errObj["message"].(string)
 		if ok {
 			return &Event{
 				Seq: seq,
 				Error: &ErrorEvent{
-					Status:  int64(errObj["status"].(float64)),
+					Status:  status,
 					Message: &msg,
 				},
 			}, nil
@@ -79,7 +105,7 @@ func parseEvent(msg []byte) (*Event, error) {
 		return &Event{
 			Seq: seq,
 			Error: &ErrorEvent{
-				Status: int64(errObj["status"].(float64)),
+				Status: status,
 			},
 		}, nil
 	} else if val, ok := evMap["Insert"]; ok {
@@ -107,3 +133,87 @@ func parseEvent(msg []byte) (*Event, error) {
 
 	return nil, nil
 }
+
+// EventType is the kind of change an event reports, see ChangeEvent.
+type EventType int
+
+const (
+	EventInsert EventType = iota + 1
+	EventUpdate
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInsert:
+		return "Insert"
+	case EventUpdate:
+		return "Update"
+	case EventDelete:
+		return "Delete"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// ChangeEvent is a subscription event decoded into the API's record type, see
+// RecordApi.DecodeChangeEvent.
+type ChangeEvent[T any] struct {
+	Type EventType
+	Seq  *int64
+	// Id is the changed record's primary key, nil if the record lacks the
+	// requested id column, e.g. because it is excluded from the API.
+	Id RecordId
+	// Record is the record after the change or, for deletes, the deleted
+	// record, which the server sends along.
+	Record *T
+}
+
+// DecodeChangeEvent decodes an event received from Subscribe or SubscribeAll
+// into a ChangeEvent, reading the record's id from idColumn, e.g. "id". Error
+// events are returned as *ErrorEvent errors.
+func (r *RecordApi[T]) DecodeChangeEvent(ev Event, idColumn string) (*ChangeEvent[T], error) {
+	if ev.Error != nil {
+		return nil, ev.Error
+	}
+
+	var eventType EventType
+	switch ev.Value.(type) {
+	case *InsertEvent:
+		eventType = EventInsert
+	case *UpdateEvent:
+		eventType = EventUpdate
+	case *DeleteEvent:
+		eventType = EventDelete
+	default:
+		return nil, fmt.Errorf("unexpected event: %T", ev.Value)
+	}
+	value := *ev.Value.Value()
+
+	var id RecordId
+	if rawId, ok := value[idColumn]; ok && rawId != nil {
+		parsed, err := ParseRecordId(fmt.Sprint(rawId))
+		if err != nil {
+			return nil, err
+		}
+		id = parsed
+	}
+
+	// Numbers were decoded as json.Number, which encoding/json re-encodes
+	// losslessly.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var record T
+	if err := r.client.codec.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	return &ChangeEvent[T]{
+		Type:   eventType,
+		Seq:    ev.Seq,
+		Id:     id,
+		Record: &record,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package trailbase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+)
+
+var (
+	// ErrInvalidSignature is returned when a JWT's signature does not match the
+	// server's public key, e.g. because the token was tampered with.
+	ErrInvalidSignature = errors.New("invalid JWT signature")
+	// ErrTokenExpired is returned when a JWT's signature is valid but it has
+	// expired.
+	ErrTokenExpired = errors.New("JWT expired")
+)
+
+// ParsePublicKey parses a TrailBase server's PEM-encoded Ed25519 public key,
+// as found in "<traildepot>/secrets/keys/public_key.pem", for use with VerifyJWT.
+func ParsePublicKey(pemBytes []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected public key type: %T", key)
+	}
+	return edKey, nil
+}
+
+// VerifyJWT checks that the auth token was signed by the server owning
+// publicKey and has not expired, and returns its claims. Unlike the claims
+// exposed by Client, which trusts the tokens it was handed by the server, this
+// is meant for validating tokens received from third parties, e.g. in a
+// service's authentication middleware.
+func VerifyJWT(token string, publicKey ed25519.PublicKey) (*JwtTokenClaims, error) {
+	return verifyJwt(token, publicKey, time.Now())
+}
+
+func verifyJwt(token string, publicKey ed25519.PublicKey, now time.Time) (*JwtTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Invalid JWT format")
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, err
+	}
+	// TrailBase exclusively signs with Ed25519. Checking prevents algorithm
+	// confusion, e.g. "none".
+	if header.Alg != "EdDSA" {
+		return nil, fmt.Errorf("unexpected JWT algorithm: %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	claims, err := decodeJwtTokenClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Unix(claims.Exp, 0).After(now) {
+		return nil, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// VerifyJWT is like the package-level VerifyJWT but fetches the server's
+// public key, which is cached for subsequent calls, see WithAuthConfigTTL and
+// RefreshAuthConfig. Fetching the key requires the client to be logged in as
+// an admin.
+func (c *Client) VerifyJWT(ctx context.Context, token string) (*JwtTokenClaims, error) {
+	publicKey, err := c.serverPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return verifyJwt(token, publicKey, c.clock())
+}
+
+// RefreshAuthConfig re-fetches the server's public key used by
+// Client.VerifyJWT, e.g. after the server's keys were rotated. Like VerifyJWT,
+// it requires admin access, see AdminRequiredError.
+func (c *Client) RefreshAuthConfig(ctx context.Context) error {
+	_, err := c.fetchPublicKey(ctx)
+	return err
+}
+
+func (c *Client) serverPublicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	c.publicKeyMutex.Lock()
+	publicKey, fetched := c.publicKey, c.publicKeyFetched
+	c.publicKeyMutex.Unlock()
+
+	if publicKey != nil && (c.authConfigTTL <= 0 || c.clock().Before(fetched.Add(c.authConfigTTL))) {
+		return publicKey, nil
+	}
+	return c.fetchPublicKey(ctx)
+}
+
+// fetchPublicKey fetches and caches the server's public key. Like ServerInfo,
+// it doesn't hold the lock while fetching, such that concurrent callers aren't
+// held up by one another's slow or canceled requests.
+func (c *Client) fetchPublicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	fetched := c.clock()
+	resp, err := c.Do(ctx, "GET", adminApi+"/public_key", nil, nil)
+	if err != nil {
+		return nil, asAdminRequiredError(err)
+	}
+	defer resp.Body.Close()
+
+	pemBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := ParsePublicKey(bytes.TrimSpace(pemBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	c.publicKeyMutex.Lock()
+	defer c.publicKeyMutex.Unlock()
+	// Don't replace a key from a fetch that started later, e.g. a concurrent
+	// RefreshAuthConfig.
+	if !fetched.Before(c.publicKeyFetched) {
+		c.publicKey = publicKey
+		c.publicKeyFetched = fetched
+	}
+	return publicKey, nil
+}
+
+const adminApi string = "api/_admin"
@@ -0,0 +1,187 @@
+package trailbase
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey, []byte) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assertFine(t, err)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	assertFine(t, err)
+	return publicKey, privateKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signTestJwt(privateKey ed25519.PrivateKey, alg string, claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	signingInput := encode(fmt.Appendf(nil, `{"alg":%q,"typ":"JWT"}`, alg)) + "." + encode([]byte(claims))
+	return signingInput + "." + encode(ed25519.Sign(privateKey, []byte(signingInput)))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	_, privateKey, pemBytes := newTestKey(t)
+	publicKey, err := ParsePublicKey(pemBytes)
+	assertFine(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signTestJwt(privateKey, "EdDSA", fmt.Sprintf(`{"sub":"user","iat":0,"exp":%d,"csrf_token":"csrf"}`, exp))
+
+	claims, err := VerifyJWT(token, publicKey)
+	assertFine(t, err)
+	assertEqual(t, "user", claims.Sub)
+	assertEqual(t, exp, claims.Exp)
+
+	// Tampered claims with the original signature.
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, `{"sub":"admin","iat":0,"exp":%d,"csrf_token":"csrf"}`, exp))
+	_, err = VerifyJWT(strings.Join(parts, "."), publicKey)
+	assert(t, errors.Is(err, ErrInvalidSignature), fmt.Sprint("expected invalid signature, got ", err))
+
+	// Signed by another key.
+	_, otherKey, _ := newTestKey(t)
+	_, err = VerifyJWT(signTestJwt(otherKey, "EdDSA", `{"sub":"user","exp":9999999999}`), publicKey)
+	assert(t, errors.Is(err, ErrInvalidSignature), fmt.Sprint("expected invalid signature, got ", err))
+
+	// Expired.
+	_, err = VerifyJWT(signTestJwt(privateKey, "EdDSA", `{"sub":"user","exp":1}`), publicKey)
+	assert(t, errors.Is(err, ErrTokenExpired), fmt.Sprint("expected expired token, got ", err))
+
+	// Unexpected algorithm.
+	_, err = VerifyJWT(signTestJwt(privateKey, "none", `{"sub":"user","exp":9999999999}`), publicKey)
+	assert(t, err != nil, "expected algorithm to be rejected")
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	assert(t, err != nil, "expected error for invalid PEM")
+}
+
+func TestClientVerifyJWT(t *testing.T) {
+	_, privateKey, pemBytes := newTestKey(t)
+
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/_admin/public_key" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		w.Write(pemBytes)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+
+	token := signTestJwt(privateKey, "EdDSA", fmt.Sprintf(`{"sub":"user","exp":%d}`, time.Now().Add(time.Hour).Unix()))
+	for range 2 {
+		claims, err := client.VerifyJWT(t.Context(), token)
+		assertFine(t, err)
+		assertEqual(t, "user", claims.Sub)
+	}
+	assertEqual(t, int64(1), fetches.Load())
+
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`))
+	_, err = client.VerifyJWT(t.Context(), strings.Join(parts, "."))
+	assert(t, errors.Is(err, ErrInvalidSignature), fmt.Sprint("expected invalid signature, got ", err))
+}
+
+func TestAuthConfigCache(t *testing.T) {
+	_, oldKey, oldPem := newTestKey(t)
+	_, newKey, newPem := newTestKey(t)
+
+	var current atomic.Pointer[[]byte]
+	current.Store(&oldPem)
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(*current.Load())
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithAuthConfigTTL(time.Hour))
+	assertFine(t, err)
+	now := time.Now()
+	client.clock = func() time.Time { return now }
+
+	claims := fmt.Sprintf(`{"sub":"user","exp":%d}`, now.Add(24*time.Hour).Unix())
+	oldToken := signTestJwt(oldKey, "EdDSA", claims)
+	newToken := signTestJwt(newKey, "EdDSA", claims)
+
+	for range 100 {
+		_, err := client.VerifyJWT(t.Context(), oldToken)
+		assertFine(t, err)
+	}
+	assertEqual(t, int64(1), fetches.Load())
+
+	// Key rotation isn't noticed until the TTL expires or a forced refresh.
+	current.Store(&newPem)
+	_, err = client.VerifyJWT(t.Context(), newToken)
+	assert(t, errors.Is(err, ErrInvalidSignature), fmt.Sprint("expected invalid signature, got ", err))
+
+	now = now.Add(2 * time.Hour)
+	_, err = client.VerifyJWT(t.Context(), newToken)
+	assertFine(t, err)
+	assertEqual(t, int64(2), fetches.Load())
+
+	current.Store(&oldPem)
+	assertFine(t, client.RefreshAuthConfig(t.Context()))
+	assertEqual(t, int64(3), fetches.Load())
+	_, err = client.VerifyJWT(t.Context(), oldToken)
+	assertFine(t, err)
+}
+
+func TestClientVerifyJWTConcurrent(t *testing.T) {
+	_, privateKey, pemBytes := newTestKey(t)
+
+	release := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request hangs until released.
+		if requests.Add(1) == 1 {
+			<-release
+		}
+		w.Write(pemBytes)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+	token := signTestJwt(privateKey, "EdDSA", fmt.Sprintf(`{"sub":"user","exp":%d}`, time.Now().Add(time.Hour).Unix()))
+
+	hanging, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.VerifyJWT(hanging, token)
+		done <- err
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other callers aren't held up by the hanging fetch.
+	claims, err := client.VerifyJWT(t.Context(), token)
+	assertFine(t, err)
+	assertEqual(t, "user", claims.Sub)
+
+	cancel()
+	assert(t, errors.Is(<-done, context.Canceled), "expected canceled request")
+
+	_, err = client.VerifyJWT(t.Context(), token)
+	assertFine(t, err)
+	assertEqual(t, int64(2), requests.Load())
+}
@@ -0,0 +1,324 @@
+package trailbase
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// ClientOption configures optional behavior of a Client, see NewClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	timeout     time.Duration
+	transport   Transport
+	requestDump io.Writer
+	codec       Codec
+	metrics     MetricsObserver
+	debugLogger *slog.Logger
+
+	refreshLeeway     time.Duration
+	backgroundRefresh context.Context
+
+	httpClient          *http.Client
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	maxIdleConns        int
+	idleConnTimeout     time.Duration
+	insecureSkipVerify  bool
+	rootCAs             *x509.CertPool
+
+	authConfigTTL time.Duration
+
+	defaultHeaders []Header
+
+	strictStructValidation bool
+
+	maxPageLimit uint64
+
+	maxRequestBodySize int
+
+	authApiPath        string
+	recordApiPath      string
+	transactionApiPath string
+}
+
+// WithTimeout bounds every request, including reading its response body, to
+// the given duration. Requests exceeding it fail with an error matching
+// context.DeadlineExceeded. Realtime subscriptions are exempt.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
+
+// WithTransport replaces the default HTTP transport, e.g. with a fake for
+// testing. The transport's BaseUrl takes precedence over the one passed to
+// NewClient.
+func WithTransport(transport Transport) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+// WithRequestDump writes every outgoing request and the corresponding response,
+// including bodies, to w for troubleshooting. Credential headers, cookies and
+// JSON fields holding passwords or tokens are redacted. Has no effect in
+// combination with WithTransport.
+func WithRequestDump(w io.Writer) ClientOption {
+	return func(o *clientOptions) {
+		o.requestDump = w
+	}
+}
+
+// WithCodec replaces encoding/json for (de)serializing records and record API
+// payloads, e.g. with a faster, API-compatible JSON library. The codec must
+// honor `json` struct tags as well as json.Marshaler implementations.
+func WithCodec(codec Codec) ClientOption {
+	return func(o *clientOptions) {
+		o.codec = codec
+	}
+}
+
+// MetricsObserver is notified about every completed request, e.g. to feed
+// request counters and latency histograms.
+type MetricsObserver interface {
+	// ObserveRequest is called with the request's method, its path relative to
+	// the base URL, the response status, or 0 if no response was received, and
+	// the time until the response headers were received.
+	ObserveRequest(method string, path string, status int, dur time.Duration)
+}
+
+// WithMetrics registers an observer for all requests issued by the client.
+func WithMetrics(observer MetricsObserver) ClientOption {
+	return func(o *clientOptions) {
+		o.metrics = observer
+	}
+}
+
+// WithRefreshLeeway sets how long before their expiry auth tokens are
+// proactively refreshed. Defaults to 60s.
+func WithRefreshLeeway(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.refreshLeeway = d
+	}
+}
+
+const defaultRefreshLeeway = 60 * time.Second
+
+// WithBackgroundRefresh refreshes auth tokens in a background goroutine ahead
+// of their expiry, rather than lazily as part of the first request within the
+// refresh leeway, which keeps request latency predictable. The goroutine runs
+// until ctx is done or the client is closed, see Client.Close. While the
+// client is logged out, it idles without issuing requests until the client is
+// authenticated again. Clones do not inherit the background refresh.
+func WithBackgroundRefresh(ctx context.Context) ClientOption {
+	return func(o *clientOptions) {
+		o.backgroundRefresh = ctx
+	}
+}
+
+const (
+	// The background refresh fires this long before the lazy refresh would, to
+	// not race it.
+	backgroundRefreshAhead = 30 * time.Second
+	// Delay before retrying a failed background refresh.
+	backgroundRefreshRetryDelay = 5 * time.Second
+)
+
+// WithHTTPClient makes the client issue requests using httpClient, e.g. to
+// configure TLS or proxies. Connection pool options like WithMaxConnsPerHost
+// are ignored in this case and have to be set on httpClient's transport
+// instead.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithMaxIdleConnsPerHost sets how many idle connections to the server are
+// kept for reuse. Go's default of 2 is low, since all requests go to a single
+// host. For concurrent workloads, a value close to the number of concurrent
+// requests, e.g. 32 or 64, avoids constantly re-establishing connections.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost limits the total number of connections to the server,
+// including active ones. Defaults to no limit. Setting a limit, e.g. matching
+// the server's capacity, bounds resource usage under bursts; excess requests
+// wait for a connection to become available.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxConnsPerHost = n
+	}
+}
+
+// WithMaxIdleConns limits the total number of idle connections kept for reuse.
+// Go's default of 100 is ample for a single server, so this mostly matters to
+// cap resources. Ignored in combination with WithHTTPClient.
+func WithMaxIdleConns(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithIdleConnTimeout sets how long idle connections are kept for reuse.
+// Clients issuing requests in bursts, e.g. periodic jobs logging in, should
+// choose a timeout exceeding the interval between bursts to avoid repeated TLS
+// handshakes. Go's default is 90s. Ignored in combination with WithHTTPClient.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.idleConnTimeout = d
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the server's TLS
+// certificate, e.g. a self-signed one in local development.
+//
+// WARNING: This makes the client vulnerable to man-in-the-middle attacks,
+// which can steal credentials and tokens. Never use it in production; prefer
+// WithRootCAs to trust a specific certificate instead. Cannot be combined with
+// WithHTTPClient.
+func WithInsecureSkipVerify() ClientOption {
+	return func(o *clientOptions) {
+		o.insecureSkipVerify = true
+	}
+}
+
+// WithRootCAs makes the client trust server certificates issued by pool rather
+// than the system's root CAs, e.g. for a staging server with a certificate
+// signed by a private CA. Cannot be combined with WithHTTPClient.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(o *clientOptions) {
+		o.rootCAs = pool
+	}
+}
+
+// WithDebugLogger logs every request's method, URL, headers, body size,
+// response status and latency to logger at debug level, e.g. to troubleshoot
+// failing calls. Credential headers are redacted. Unlike WithRequestDump,
+// bodies are not logged and custom transports are supported.
+func WithDebugLogger(logger *slog.Logger) ClientOption {
+	return func(o *clientOptions) {
+		o.debugLogger = logger
+	}
+}
+
+// WithDefaultHeaders adds headers to every request, e.g. "Accept-Language" or
+// a tenant id expected by a proxy. They cannot override headers set by the
+// client itself, such as "Content-Type" or "Authorization".
+func WithDefaultHeaders(headers ...Header) ClientOption {
+	return func(o *clientOptions) {
+		o.defaultHeaders = append(o.defaultHeaders, headers...)
+	}
+}
+
+// WithAuthConfigTTL limits how long the server's public key fetched by
+// Client.VerifyJWT is cached before being re-fetched. By default, the key is
+// cached until RefreshAuthConfig is called. Since TrailBase tokens carry no
+// key id, a rotated key cannot be detected from a token. Set a TTL to pick up
+// rotations automatically.
+func WithAuthConfigTTL(ttl time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.authConfigTTL = ttl
+	}
+}
+
+// WithStrictStructValidation makes NewRecordApi check the record type for
+// common mistakes during development and log warnings, e.g. for unexported
+// fields with a json tag, which encoding/json silently ignores. It is opt-in
+// to avoid the reflection overhead in production. See also
+// RecordApi.ValidateSchema.
+func WithStrictStructValidation() ClientOption {
+	return func(o *clientOptions) {
+		o.strictStructValidation = true
+	}
+}
+
+// WithMaxPageLimit caps the Limit of list requests at n, e.g. to protect
+// against accidentally huge pages. Larger limits are silently lowered rather
+// than rejected by the server, whose hard limit is 1024 unless configured
+// otherwise.
+func WithMaxPageLimit(n uint64) ClientOption {
+	return func(o *clientOptions) {
+		o.maxPageLimit = n
+	}
+}
+
+// WithMaxRequestBodySize makes requests whose body exceeds n bytes, e.g.
+// records with large embedded blobs, fail with ErrRequestBodyTooLarge before
+// being sent, rather than being rejected by the server or a proxy after
+// uploading them. Streamed bodies, see RecordApi.CreateMultipart, fail once
+// the limit is exceeded while sending.
+func WithMaxRequestBodySize(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxRequestBodySize = n
+	}
+}
+
+// WithAuthApiPath overrides the base path of the auth API, "api/auth/v1" by
+// default, e.g. to target a future API version.
+func WithAuthApiPath(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.authApiPath = strings.Trim(path, "/")
+	}
+}
+
+// WithRecordApiPath overrides the base path of record APIs, "api/records/v1"
+// by default.
+func WithRecordApiPath(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.recordApiPath = strings.Trim(path, "/")
+	}
+}
+
+// WithTransactionApiPath overrides the base path of the transaction API,
+// "api/transaction/v1" by default.
+func WithTransactionApiPath(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.transactionApiPath = strings.Trim(path, "/")
+	}
+}
+
+// buildHttpClient returns the HTTP client to be used by the default transport.
+func (o *clientOptions) buildHttpClient() *http.Client {
+	if o.httpClient != nil {
+		return o.httpClient
+	}
+	if o.maxIdleConnsPerHost == 0 && o.maxConnsPerHost == 0 && o.maxIdleConns == 0 && o.idleConnTimeout == 0 && !o.insecureSkipVerify && o.rootCAs == nil {
+		return &http.Client{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.maxIdleConnsPerHost
+		if transport.MaxIdleConns < o.maxIdleConnsPerHost {
+			transport.MaxIdleConns = o.maxIdleConnsPerHost
+		}
+	}
+	if o.maxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = o.maxConnsPerHost
+	}
+	if o.maxIdleConns > 0 {
+		transport.MaxIdleConns = o.maxIdleConns
+	}
+	if o.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = o.idleConnTimeout
+	}
+	if o.insecureSkipVerify || o.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: o.insecureSkipVerify,
+			RootCAs:            o.rootCAs,
+		}
+	}
+	return &http.Client{Transport: transport}
+}
@@ -1,12 +1,29 @@
 package trailbase
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"reflect"
 )
 
 type RecordId interface {
@@ -25,96 +42,644 @@ func (id StringRecordId) ToString() string {
 	return string(id)
 }
 
+// UUIDRecordId is the id of a record with a UUID primary key, e.g. a
+// uuid_v7() column. It is sent in the padded, URL-safe base64 encoding the
+// server uses for BLOB ids.
+type UUIDRecordId [16]byte
+
+func (id UUIDRecordId) ToString() string {
+	return base64.URLEncoding.EncodeToString(id[:])
+}
+
+// String returns the canonical, hyphenated hex form, e.g.
+// "01890a5d-ac96-774b-bcce-b302099a8057".
+func (id UUIDRecordId) String() string {
+	h := hex.EncodeToString(id[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// ParseRecordId parses an id as returned by the server, e.g. by Create, into
+// the most specific RecordId: integers become IntRecordId, UUIDs in either the
+// hyphenated hex form or the server's base64 encoding become UUIDRecordId and
+// everything else a StringRecordId. Note that a TEXT primary key that happens
+// to look like a UUID is parsed as UUIDRecordId, too; use StringRecordId
+// directly for such tables.
+func ParseRecordId(id string) (RecordId, error) {
+	if id == "" {
+		return nil, errors.New("empty record id")
+	}
+	if i, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return IntRecordId(i), nil
+	}
+	if len(id) == 36 {
+		if uuid, ok := parseHexUUID(id); ok {
+			return uuid, nil
+		}
+	}
+	if len(id) == base64.URLEncoding.EncodedLen(16) {
+		if b, err := base64.URLEncoding.DecodeString(id); err == nil && len(b) == 16 {
+			return UUIDRecordId(b), nil
+		}
+	}
+	return StringRecordId(id), nil
+}
+
+func parseHexUUID(s string) (UUIDRecordId, bool) {
+	var uuid UUIDRecordId
+	if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return uuid, false
+	}
+	h := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(uuid[:], []byte(h)); err != nil {
+		return uuid, false
+	}
+	return uuid, true
+}
+
 type RecordIdResponse struct {
 	Ids []string `json:"ids"`
 }
 
+// Cursor is an opaque token handed out by the server to continue listing
+// after the last record of a page. Cursors must come from a prior
+// ListResponse, they are not meant to be constructed or modified. Converting
+// from a string is only sensible for cursors stored from an earlier response,
+// e.g. `Cursor(saved)`.
+type Cursor string
+
+// IsEmpty reports whether c is absent, i.e. nil or empty.
+func (c *Cursor) IsEmpty() bool {
+	return c == nil || *c == ""
+}
+
 type ListResponse[T any] struct {
-	Records    []T     `json:"records"`
-	Cursor     *string `json:"cursor,omitempty"`
+	Records []T `json:"records"`
+	// Cursor continues listing after this page. The server hands out cursors
+	// for every non-empty page of a table ordered by primary key, including
+	// the last one, and never for views or custom orders. Its absence thus
+	// does not indicate the end of the data, see HasMore.
+	Cursor     *Cursor `json:"cursor,omitempty"`
 	TotalCount *int64  `json:"total_count,omitempty"`
 }
 
+// HasMore reports whether a following page may hold more records. Filters are
+// applied before the limit, so the server only returns an empty page once all
+// matching records have been listed, whether or not a cursor was handed out.
+func (r *ListResponse[T]) HasMore() bool {
+	return len(r.Records) > 0
+}
+
+// ResponseMeta holds the status and headers of a response whose body has
+// already been consumed.
+type ResponseMeta struct {
+	StatusCode int
+	Header     http.Header
+}
+
+func newResponseMeta(resp *http.Response) *ResponseMeta {
+	return &ResponseMeta{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+}
+
 type RecordApi[T any] struct {
 	client *Client
 	name   string
 }
 
 func (r *RecordApi[T]) Create(record T) (RecordId, error) {
-	reqBody, err := json.Marshal(record)
+	return r.createWithContext(context.Background(), record)
+}
+
+func (r *RecordApi[T]) createWithContext(ctx context.Context, record T) (RecordId, error) {
+	reqBody, err := r.client.codec.Marshal(record)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := r.client.do("POST", fmt.Sprintf("%s/%s", recordApi, r.name), reqBody, nil)
+	ctx, cancel := r.client.newRequestContextFrom(ctx)
+	defer cancel()
+
+	resp, err := r.client.doWithContext(ctx, "POST", r.path(), nil, reqBody, nil)
 	if err != nil {
+		return nil, asValidationError(err)
+	}
+	defer resp.Body.Close()
+
+	return decodeCreatedId(r.client.codec, resp)
+}
+
+// decodeCreatedId extracts the id of a single created record from resp. For
+// compatibility with proxies and other servers, a response without ids, e.g.
+// 201 or 204 without content, is accepted if the Location header points at
+// the record.
+func decodeCreatedId(codec Codec, resp *http.Response) (RecordId, error) {
+	body := bufio.NewReader(resp.Body)
+	if _, err := body.Peek(1); err == io.EOF {
+		return locationId(resp)
+	}
+
+	var recordIdResponse RecordIdResponse
+	if err := decodeBody(codec, body, &recordIdResponse); err != nil {
 		return nil, err
 	}
-	respBody, err := io.ReadAll(resp.Body)
+
+	switch len(recordIdResponse.Ids) {
+	case 0:
+		return locationId(resp)
+	case 1:
+		return StringRecordId(recordIdResponse.Ids[0]), nil
+	default:
+		return nil, errors.New("expected one id")
+	}
+}
+
+// locationId returns the trailing path segment of resp's Location header.
+func locationId(resp *http.Response) (RecordId, error) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, errors.New("expected one id, got neither ids nor Location")
+	}
+	locationUrl, err := url.Parse(location)
 	if err != nil {
 		return nil, err
 	}
+	id := path.Base(locationUrl.Path)
+	if id == "." || id == "/" {
+		return nil, fmt.Errorf("no id in Location: %q", location)
+	}
+	return StringRecordId(id), nil
+}
+
+// CreateManyOptions configures CreateMany.
+type CreateManyOptions struct {
+	// BestEffort creates records one by one, such that valid records are
+	// created even if others are rejected. By default, all records are created
+	// in a single request and server-side transaction, i.e. either all or none
+	// are created. The option is phrased as the opt-out of transactional
+	// creation for the zero value to keep the all-or-nothing default.
+	//
+	// Since the server's bulk create is always transactional and its
+	// non-transactional batches, see TransactionBatch.SendWithoutTransaction,
+	// stop at the first failure, best-effort mode issues one request per
+	// record, i.e. N requests for N records.
+	BestEffort bool
+}
+
+// CreateError is a failure to create the record at Index of the input to
+// CreateMany in best-effort mode.
+type CreateError struct {
+	Index int
+	Err   error
+}
+
+func (e *CreateError) Error() string {
+	return fmt.Sprintf("CreateError(index: %d, %v)", e.Index, e.Err)
+}
+
+func (e *CreateError) Unwrap() error {
+	return e.Err
+}
+
+// CreateMany creates multiple records, see CreateManyOptions. The returned ids
+// correspond to the input records by index. In best-effort mode, ids of
+// records that failed to be created are nil and the failures are returned as
+// CreateErrors instead of an error.
+func (r *RecordApi[T]) CreateMany(records []T, opts *CreateManyOptions) ([]RecordId, []CreateError, error) {
+	return r.CreateManyWithContext(context.Background(), records, opts)
+}
+
+// CreateManyWithContext is like CreateMany but binds the requests to ctx. In
+// best-effort mode, canceling ctx stops creating further records and returns
+// the results so far along with ctx's error.
+func (r *RecordApi[T]) CreateManyWithContext(ctx context.Context, records []T, opts *CreateManyOptions) ([]RecordId, []CreateError, error) {
+	if opts != nil && opts.BestEffort {
+		ids := make([]RecordId, len(records))
+		var createErrors []CreateError
+		for i, record := range records {
+			if err := ctx.Err(); err != nil {
+				return ids, createErrors, err
+			}
+			id, err := r.createWithContext(ctx, record)
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ids, createErrors, ctxErr
+				}
+				createErrors = append(createErrors, CreateError{Index: i, Err: err})
+				continue
+			}
+			ids[i] = id
+		}
+		return ids, createErrors, nil
+	}
+
+	ids, err := r.createManyWithContext(ctx, records)
+	return ids, nil, err
+}
+
+// createManyWithContext creates records in a single request, i.e. all or none.
+func (r *RecordApi[T]) createManyWithContext(ctx context.Context, records []T) ([]RecordId, error) {
+	reqBody, err := r.client.codec.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := r.client.newRequestContextFrom(ctx)
+	defer cancel()
+
+	resp, err := r.client.doWithContext(ctx, "POST", r.path(), nil, reqBody, nil)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	defer resp.Body.Close()
 
 	var recordIdResponse RecordIdResponse
-	err = json.Unmarshal(respBody, &recordIdResponse)
+	err = decodeBody(r.client.codec, resp.Body, &recordIdResponse)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(recordIdResponse.Ids) != 1 {
-		return nil, errors.New("expected one id")
+	if len(recordIdResponse.Ids) != len(records) {
+		return nil, fmt.Errorf("expected %d ids, got %d", len(records), len(recordIdResponse.Ids))
+	}
+	ids := make([]RecordId, len(recordIdResponse.Ids))
+	for i, id := range recordIdResponse.Ids {
+		ids[i] = StringRecordId(id)
+	}
+	return ids, nil
+}
+
+// ImportJSONL creates the records read from r, one JSON object per line, e.g.
+// as written by ExportJSONL. Records are streamed and created in batches of
+// batchSize, each of which is created atomically, see CreateMany. If non-nil,
+// progress is called with the total number of created records after every
+// batch. It returns the number of created records, which on error is the
+// number of records in the batches created before the failure.
+func (r *RecordApi[T]) ImportJSONL(ctx context.Context, reader io.Reader, batchSize int, progress func(imported int64)) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("invalid batch size: %d", batchSize)
+	}
+
+	var imported int64
+	flush := func(batch []T) error {
+		if _, err := r.createManyWithContext(ctx, batch); err != nil {
+			return err
+		}
+		imported += int64(len(batch))
+		if progress != nil {
+			progress(imported)
+		}
+		return nil
+	}
+
+	buffered := bufio.NewReader(reader)
+	batch := make([]T, 0, batchSize)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := buffered.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return imported, readErr
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var record T
+			if err := r.client.codec.Unmarshal(trimmed, &record); err != nil {
+				return imported, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			batch = append(batch, record)
+
+			if len(batch) == batchSize {
+				if err := flush(batch); err != nil {
+					return imported, err
+				}
+				batch = batch[:0]
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// ValidationError is returned by Create, CreateMany, CreateMultipart and
+// Update when the server rejects the record with 400 Bad Request, e.g. because
+// it violates a database constraint. The server deliberately does not disclose which column
+// caused the violation, only the kind of constraint.
+type ValidationError struct {
+	// Constraint is the kind of violated database constraint, e.g. "not null",
+	// "unique", "check" or "fk". Empty if the record was rejected for other
+	// reasons, e.g. malformed input.
+	Constraint string
+
+	*FetchError
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("ValidationError(constraint: %q, %s)", e.Constraint, e.FetchError)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.FetchError
+}
+
+// asValidationError wraps 400 responses to record mutations in a
+// ValidationError and passes through all other errors.
+func asValidationError(err error) error {
+	var ferr *FetchError
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+	constraint, _ := strings.CutPrefix(strings.TrimSpace(ferr.Message), "db constraint: ")
+	if constraint == strings.TrimSpace(ferr.Message) {
+		constraint = ""
 	}
-	return StringRecordId(recordIdResponse.Ids[0]), nil
+	return &ValidationError{Constraint: constraint, FetchError: ferr}
+}
+
+// FileUpload is a file to be stored in a record's file column, see
+// CreateMultipart.
+type FileUpload struct {
+	Filename string
+	// ContentType defaults to "application/octet-stream" if empty.
+	ContentType string
+	Content     io.Reader
 }
 
-func (r *RecordApi[T]) Read(id RecordId) (*T, error) {
-	resp, err := r.client.do("GET", fmt.Sprintf("%s/%s/%s", recordApi, r.name, id.ToString()), nil, nil)
+// CreateMultipart is like Create but additionally uploads files into the
+// record's file columns, keyed by column name, in a single request.
+//
+// The record's fields are sent as form fields, which the server coerces to the
+// columns' types. Nested objects and arrays are sent as JSON text and null
+// fields are omitted. The body is streamed rather than assembled in memory,
+// i.e. files are read while being sent, unless a custom transport doesn't
+// implement StreamingTransport. Since files cannot be re-read, the request is
+// not retried after a 401 response.
+func (r *RecordApi[T]) CreateMultipart(ctx context.Context, record T, files map[string]FileUpload) (RecordId, error) {
+	encoded, err := r.client.codec.Marshal(record)
 	if err != nil {
 		return nil, err
 	}
-	respBody, err := io.ReadAll(resp.Body)
+	var fields map[string]json.RawMessage
+	if err := r.client.codec.Unmarshal(encoded, &fields); err != nil {
+		return nil, fmt.Errorf("record must encode as a JSON object: %w", err)
+	}
+
+	// Convert fields up front to fail before sending anything.
+	formFields := make([][2]string, 0, len(fields))
+	// Sort for deterministic requests.
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		value, ok, err := formFieldValue(fields[name])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			formFields = append(formFields, [2]string{name, value})
+		}
+	}
+
+	body, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(bodyWriter)
+	written := make(chan error, 1)
+	go func() {
+		err := writeMultipart(writer, formFields, files)
+		bodyWriter.CloseWithError(err)
+		written <- err
+	}()
+
+	ctx, cancel := r.client.newRequestContextFrom(ctx)
+	defer cancel()
+
+	headers := []Header{{key: "Content-Type", value: writer.FormDataContentType()}}
+	resp, err := r.client.doStreamWithContext(ctx, "POST", r.path(), headers, body, nil)
+
+	// Unblock the writer if the body wasn't consumed, e.g. on early errors, and
+	// wait for it to not read files after returning.
+	body.Close()
+	if writeErr := <-written; writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+		return nil, writeErr
+	}
 	if err != nil {
-		return nil, err
+		return nil, asValidationError(err)
+	}
+	defer resp.Body.Close()
+
+	return decodeCreatedId(r.client.codec, resp)
+}
+
+// writeMultipart writes the form fields followed by the files and closes
+// writer.
+func writeMultipart(writer *multipart.Writer, fields [][2]string, files map[string]FileUpload) error {
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range slices.Sorted(maps.Keys(files)) {
+		file := files[column]
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		partHeader := textproto.MIMEHeader{}
+		partHeader.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     column,
+			"filename": file.Filename,
+		}))
+		partHeader.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(partHeader)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return err
+		}
 	}
+	return writer.Close()
+}
 
+// formFieldValue converts a JSON value into its form field representation.
+// It returns false for null values, which are to be omitted.
+func formFieldValue(raw json.RawMessage) (string, bool, error) {
+	trimmed := bytes.TrimSpace(raw)
+	switch {
+	case bytes.Equal(trimmed, []byte("null")):
+		return "", false, nil
+	case bytes.Equal(trimmed, []byte("true")):
+		// SQLite has no booleans.
+		return "1", true, nil
+	case bytes.Equal(trimmed, []byte("false")):
+		return "0", true, nil
+	case bytes.HasPrefix(trimmed, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return "", false, err
+		}
+		return s, true, nil
+	default:
+		// Numbers as well as nested objects and arrays.
+		return string(trimmed), true, nil
+	}
+}
+
+// CallOption configures a single call, e.g. Read.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout time.Duration
+}
+
+// WithCallTimeout bounds a single call, including reading its response body,
+// taking precedence over the client's WithTimeout, e.g. to fail fast on a
+// quick read while allowing slow bulk operations.
+func WithCallTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+func newCallOptions(opts []CallOption) callOptions {
+	var options callOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func (r *RecordApi[T]) Read(id RecordId, opts ...CallOption) (*T, error) {
+	value, _, err := r.ReadWithMeta(id, opts...)
+	return value, err
+}
+
+// ReadOptional is like Read but reports a non-existent record by returning
+// found set to false rather than an error. Other failures, e.g. network
+// errors or missing permissions, are still returned as errors.
+func (r *RecordApi[T]) ReadOptional(id RecordId, opts ...CallOption) (*T, bool, error) {
+	value, err := r.Read(id, opts...)
+	if err != nil {
+		var ferr *FetchError
+		if errors.As(err, &ferr) && ferr.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// ReadWithMeta is like Read but additionally returns the response's status
+// and headers, e.g. to build caching on top.
+func (r *RecordApi[T]) ReadWithMeta(id RecordId, opts ...CallOption) (*T, *ResponseMeta, error) {
 	var value T
-	err = json.Unmarshal(respBody, &value)
+	meta, err := r.readInto(id, &value, newCallOptions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &value, meta, nil
+}
+
+// ReadInto is like Read but decodes the record into dest, e.g. to reuse
+// records in hot loops. dest is reset first, such that no fields of a
+// previously read record remain.
+func (r *RecordApi[T]) ReadInto(id RecordId, dest *T, opts ...CallOption) error {
+	_, err := r.readInto(id, dest, newCallOptions(opts))
+	return err
+}
+
+func (r *RecordApi[T]) readInto(id RecordId, dest *T, options callOptions) (*ResponseMeta, error) {
+	ctx, cancel := r.client.newRequestContextWithTimeout(context.Background(), options.timeout)
+	defer cancel()
+
+	resp, err := r.client.doWithContext(ctx, "GET", r.recordPath(id), nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &value, nil
+	defer resp.Body.Close()
+
+	var zero T
+	*dest = zero
+	if err := decodeBody(r.client.codec, resp.Body, dest); err != nil {
+		return nil, err
+	}
+	return newResponseMeta(resp), nil
 }
 
-func (r *RecordApi[T]) SubscribeAll() (<-chan Event, func(), error) {
-	return r.client.stream("GET", fmt.Sprintf("%s/%s/subscribe/*", recordApi, r.name), []byte{}, []QueryParam{})
+// SubscribeOption configures a subscription, see Subscribe.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	maxBackoff time.Duration
 }
 
-func (r *RecordApi[T]) Subscribe(id RecordId) (<-chan Event, func(), error) {
-	return r.client.stream("GET", fmt.Sprintf("%s/%s/subscribe/%s", recordApi, r.name, id.ToString()), []byte{}, []QueryParam{})
+// WithReconnect re-establishes subscriptions dropped e.g. due to network
+// errors or server restarts, waiting between attempts with exponential backoff
+// up to maxBackoff. The event channel then keeps delivering events across
+// reconnects and is only closed once the subscription is canceled or fails
+// permanently, e.g. with 403 Forbidden.
+//
+// The server neither assigns event ids nor replays missed events, i.e. changes
+// happening while disconnected are lost and Event.Seq restarts after a
+// reconnect. Consumers needing a consistent view should re-read records when
+// Seq restarts.
+func WithReconnect(maxBackoff time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.maxBackoff = maxBackoff
+	}
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	var options subscribeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// SubscribeAll subscribes to changes of all records of the API. The returned
+// function cancels the subscription.
+func (r *RecordApi[T]) SubscribeAll(opts ...SubscribeOption) (<-chan Event, func(), error) {
+	return r.client.stream("GET", r.path()+"/subscribe/*", []byte{}, []QueryParam{}, newSubscribeOptions(opts).maxBackoff)
+}
+
+// Subscribe subscribes to changes of the record with the given id. The
+// returned function cancels the subscription.
+func (r *RecordApi[T]) Subscribe(id RecordId, opts ...SubscribeOption) (<-chan Event, func(), error) {
+	return r.client.stream("GET", r.path()+"/subscribe/"+escapePathSegment(id.ToString()), []byte{}, []QueryParam{}, newSubscribeOptions(opts).maxBackoff)
 }
 
 func (r *RecordApi[T]) Update(id RecordId, record T) error {
-	reqBody, err := json.Marshal(record)
+	reqBody, err := r.client.codec.Marshal(record)
 	if err != nil {
 		return err
 	}
-	_, err = r.client.do("PATCH", fmt.Sprintf("%s/%s/%s", recordApi, r.name, id.ToString()), reqBody, nil)
+	resp, err := r.client.do("PATCH", r.recordPath(id), reqBody, nil)
 	if err != nil {
-		return err
+		return asValidationError(err)
 	}
-	return nil
+	return drainAndClose(resp.Body)
 }
 
 func (r *RecordApi[T]) Delete(id RecordId) error {
-	_, err := r.client.do("DELETE", fmt.Sprintf("%s/%s/%s", recordApi, r.name, id.ToString()), nil, nil)
+	resp, err := r.client.do("DELETE", r.recordPath(id), nil, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	return drainAndClose(resp.Body)
 }
 
 type Filter interface {
-	toParams(path string) []QueryParam
+	toParams(path string) ([]QueryParam, error)
 }
 
 type CompareOp int
@@ -127,7 +692,7 @@ const (
 	LessThanEqual
 	GreaterThan
 	GreaterThanEqual
-	Like
+	Like // SQLite's LIKE, which is case-insensitive for ASCII characters
 	Regex
 	StWithin
 	StIntersects
@@ -136,36 +701,42 @@ const (
 	IsNotNull // serializes to $is with value "!NULL"
 )
 
-func (op CompareOp) toString() string {
+// Alternative spellings of LessThanEqual and GreaterThanEqual.
+const (
+	LessThanOrEqual    = LessThanEqual
+	GreaterThanOrEqual = GreaterThanEqual
+)
+
+func (op CompareOp) toString() (string, error) {
 	switch op {
 	case Equal:
-		return "$eq"
+		return "$eq", nil
 	case NotEqual:
-		return "$ne"
+		return "$ne", nil
 	case LessThan:
-		return "$lt"
+		return "$lt", nil
 	case LessThanEqual:
-		return "$lte"
+		return "$lte", nil
 	case GreaterThan:
-		return "$gt"
+		return "$gt", nil
 	case GreaterThanEqual:
-		return "$gte"
+		return "$gte", nil
 	case Like:
-		return "$like"
+		return "$like", nil
 	case Regex:
-		return "$re"
+		return "$re", nil
 	case StWithin:
-		return "@within"
+		return "@within", nil
 	case StIntersects:
-		return "@intersects"
+		return "@intersects", nil
 	case StContains:
-		return "@contains"
+		return "@contains", nil
 	case IsNull:
-		return "$is"
+		return "$is", nil
 	case IsNotNull:
-		return "$is"
+		return "$is", nil
 	default:
-		panic(fmt.Sprint("Unknown operation:", op))
+		return "", fmt.Errorf("unknown operation: %d", op)
 	}
 }
 
@@ -175,8 +746,19 @@ type FilterColumn struct {
 	Value  string
 }
 
-func (f FilterColumn) toParams(path string) []QueryParam {
+func (f FilterColumn) toParams(path string) ([]QueryParam, error) {
+	// Brackets delimit the nested filter keys and can therefore not be
+	// represented in column names. All other characters are percent-encoded.
+	if strings.ContainsAny(f.Column, "[]") {
+		return nil, fmt.Errorf("invalid filter column name: %q", f.Column)
+	}
+
 	if f.Op != Undefined {
+		op, err := f.Op.toString()
+		if err != nil {
+			return nil, err
+		}
+
 		value := f.Value
 		if f.Op == IsNull {
 			value = "NULL"
@@ -185,17 +767,17 @@ func (f FilterColumn) toParams(path string) []QueryParam {
 		}
 		return []QueryParam{
 			QueryParam{
-				key:   fmt.Sprintf("%s[%s][%s]", path, f.Column, f.Op.toString()),
+				key:   fmt.Sprintf("%s[%s][%s]", path, f.Column, op),
 				value: value,
 			},
-		}
+		}, nil
 	}
 	return []QueryParam{
 		QueryParam{
 			key:   fmt.Sprintf("%s[%s]", path, f.Column),
 			value: f.Value,
 		},
-	}
+	}, nil
 }
 
 // IsNullFilter returns a Filter that matches rows where column IS NULL.
@@ -208,59 +790,244 @@ func IsNotNullFilter(column string) FilterColumn {
 	return FilterColumn{Column: column, Op: IsNotNull}
 }
 
+// Contains returns a Filter that matches rows where column contains substr.
+// LIKE wildcards in substr are escaped and thus matched literally.
+//
+// Escaping requires a server that declares '\' as the LIKE escape character,
+// i.e. a release after v0.31.0 (see "Unreleased" in the CHANGELOG). Older
+// servers treat the escapes as literal backslashes.
+func Contains(column string, substr string) FilterColumn {
+	return FilterColumn{Column: column, Op: Like, Value: "%" + escapeLike(substr) + "%"}
+}
+
+// StartsWith returns a Filter that matches rows where column starts with prefix.
+// Like Contains, it requires a server released after v0.31.0.
+func StartsWith(column string, prefix string) FilterColumn {
+	return FilterColumn{Column: column, Op: Like, Value: escapeLike(prefix) + "%"}
+}
+
+// EndsWith returns a Filter that matches rows where column ends with suffix.
+// Like Contains, it requires a server released after v0.31.0.
+func EndsWith(column string, suffix string) FilterColumn {
+	return FilterColumn{Column: column, Op: Like, Value: "%" + escapeLike(suffix)}
+}
+
+// AfterTime, BeforeTime and BetweenTime filter timestamp columns holding
+// seconds since the Unix epoch, e.g. INTEGER columns defaulting to UNIXEPOCH(),
+// which is TrailBase's convention. Unix timestamps are independent of time
+// zones, so t's location does not matter. Sub-second precision is truncated.
+//
+// For TEXT columns populated by SQLite's datetime() or CURRENT_TIMESTAMP, use
+// FilterColumn or FilterBetween with t.UTC().Format(time.DateTime) instead,
+// which compares correctly as a string.
+
+// AfterTime returns a Filter that matches rows where column lies strictly
+// after t.
+func AfterTime(column string, t time.Time) FilterColumn {
+	return FilterColumn{Column: column, Op: GreaterThan, Value: formatUnixTime(t)}
+}
+
+// BeforeTime returns a Filter that matches rows where column lies strictly
+// before t.
+func BeforeTime(column string, t time.Time) FilterColumn {
+	return FilterColumn{Column: column, Op: LessThan, Value: formatUnixTime(t)}
+}
+
+// BetweenTime returns a Filter that matches rows where column lies within the
+// inclusive range [from, to].
+func BetweenTime(column string, from time.Time, to time.Time) FilterBetween {
+	return FilterBetween{Column: column, Low: formatUnixTime(from), High: formatUnixTime(to)}
+}
+
+func formatUnixTime(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// escapeLike escapes LIKE's meta-characters using '\', which the server
+// declares as the LIKE escape character.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// FilterBetween matches rows where Column lies within the range [Low, High].
+// Both bounds are inclusive by default and can be made exclusive individually.
+type FilterBetween struct {
+	Column        string
+	Low           string
+	High          string
+	ExclusiveLow  bool
+	ExclusiveHigh bool
+}
+
+func (f FilterBetween) toParams(path string) ([]QueryParam, error) {
+	lowOp, highOp := GreaterThanEqual, LessThanEqual
+	if f.ExclusiveLow {
+		lowOp = GreaterThan
+	}
+	if f.ExclusiveHigh {
+		highOp = LessThan
+	}
+
+	// Multiple operators on the same column are implicitly ANDed by the server.
+	low, err := FilterColumn{Column: f.Column, Op: lowOp, Value: f.Low}.toParams(path)
+	if err != nil {
+		return nil, err
+	}
+	high, err := FilterColumn{Column: f.Column, Op: highOp, Value: f.High}.toParams(path)
+	if err != nil {
+		return nil, err
+	}
+	return append(low, high...), nil
+}
+
 type FilterAnd struct {
 	filters []Filter
 }
 
-func (f FilterAnd) toParams(path string) []QueryParam {
+// And returns a composite Filter matching rows that match all given filters.
+func And(filters ...Filter) FilterAnd {
+	return FilterAnd{filters: filters}
+}
+
+func (f FilterAnd) toParams(path string) ([]QueryParam, error) {
 	params := []QueryParam{}
 	for i, nested := range f.filters {
-		params = append(params, nested.toParams(fmt.Sprintf("%s[$and][%d]", path, i))...)
+		nestedParams, err := nested.toParams(fmt.Sprintf("%s[$and][%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, nestedParams...)
 	}
-	return params
+	return params, nil
 }
 
 type FilterOr struct {
 	filters []Filter
 }
 
-func (f FilterOr) toParams(path string) []QueryParam {
+// Or returns a composite Filter matching rows that match any of the given
+// filters.
+func Or(filters ...Filter) FilterOr {
+	return FilterOr{filters: filters}
+}
+
+func (f FilterOr) toParams(path string) ([]QueryParam, error) {
 	params := []QueryParam{}
 	for i, nested := range f.filters {
-		params = append(params, nested.toParams(fmt.Sprintf("%s[$or][%d]", path, i))...)
+		nestedParams, err := nested.toParams(fmt.Sprintf("%s[$or][%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, nestedParams...)
 	}
-	return params
+	return params, nil
 }
 
 type Pagination struct {
-	Cursor *string
+	// Cursor and Offset are mutually exclusive, setting both fails with
+	// ErrCursorAndOffset. The cursor must be taken from a previous
+	// ListResponse.
+	Cursor *Cursor
+	// Limit is the maximum number of records to return, DefaultPageLimit if
+	// unset. Larger values are lowered to the client's WithMaxPageLimit, if
+	// configured. Otherwise, the server rejects limits above the record API's
+	// hard limit, 1024 unless configured otherwise, with a 400 FetchError.
 	Limit  *uint64
 	Offset *uint64
 }
 
+// DefaultPageLimit is the number of records listed if Pagination.Limit is
+// unset, matching the server's default.
+const DefaultPageLimit uint64 = 50
+
+// ErrCursorAndOffset is returned when listing with both a cursor and an
+// offset, which are alternative ways to paginate.
+var ErrCursorAndOffset = errors.New("cursor and offset are mutually exclusive")
+
+// pageLimit returns the limit sent for the requested one, see Pagination.Limit.
+func (c *Client) pageLimit(limit *uint64) uint64 {
+	l := DefaultPageLimit
+	if limit != nil {
+		l = *limit
+	}
+	if c.maxPageLimit > 0 && l > c.maxPageLimit {
+		l = c.maxPageLimit
+	}
+	return l
+}
+
+// Order orders listed records by one of the record's own columns, see
+// ListArguments.Orders.
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// String returns the order in the prefix notation of ListArguments.Order.
+func (o Order) String() string {
+	if o.Desc {
+		return "-" + o.Column
+	}
+	return "+" + o.Column
+}
+
+// ErrOrderAndOrders is returned when listing with both ListArguments.Order and
+// ListArguments.Orders set.
+var ErrOrderAndOrders = errors.New("Order and Orders are mutually exclusive")
+
 type ListArguments struct {
-	Order   []string
+	// Order lists up to 5 of the record's own columns, optionally prefixed by
+	// "-" for descending or "+" for ascending order, e.g. `[]string{"-year"}`.
+	// The server cannot order by columns of expanded relations, e.g.
+	// "director.name".
+	Order []string
+	// Orders is a structured alternative to Order, e.g.
+	// `[]Order{{Column: "year", Desc: true}}`. Only one of them may be set.
+	Orders []Order
+	// Filters are implicitly ANDed. Use Or and And to express other boolean
+	// logic, e.g. `[]Filter{Or(a, b), c}` for "(a OR b) AND c".
 	Filters []Filter
 	Expand  []string
 	Count   bool
+	// Timeout bounds this call, taking precedence over the client's
+	// WithTimeout. A deadline of the context passed to calls taking one, e.g.
+	// PrefetchPager.Next, still applies if it expires earlier.
+	Timeout time.Duration
 
 	Pagination
 }
 
 func (r *RecordApi[T]) List(args *ListArguments) (*ListResponse[T], error) {
-	queryParams := []QueryParam{}
+	listResponse, _, err := r.ListWithMeta(args)
+	return listResponse, err
+}
+
+// ListWithMeta is like List but additionally returns the response's status
+// and headers.
+func (r *RecordApi[T]) ListWithMeta(args *ListArguments) (*ListResponse[T], *ResponseMeta, error) {
+	return r.listWithContext(context.Background(), args)
+}
+
+func (r *RecordApi[T]) listWithContext(ctx context.Context, args *ListArguments) (*ListResponse[T], *ResponseMeta, error) {
+	var limit *uint64
+	if args != nil {
+		limit = args.Limit
+	}
+	queryParams := []QueryParam{{
+		key:   "limit",
+		value: fmt.Sprint(r.client.pageLimit(limit)),
+	}}
 
 	if args != nil {
-		if args.Cursor != nil && *args.Cursor != "" {
+		if !args.Cursor.IsEmpty() {
+			if args.Offset != nil {
+				return nil, nil, ErrCursorAndOffset
+			}
 			queryParams = append(queryParams, QueryParam{
 				key:   "cursor",
-				value: *args.Cursor,
-			})
-		}
-		if args.Limit != nil {
-			queryParams = append(queryParams, QueryParam{
-				key:   "limit",
-				value: fmt.Sprint(*args.Limit),
+				value: string(*args.Cursor),
 			})
 		}
 		if args.Offset != nil {
@@ -269,10 +1036,20 @@ func (r *RecordApi[T]) List(args *ListArguments) (*ListResponse[T], error) {
 				value: fmt.Sprint(*args.Offset),
 			})
 		}
-		if len(args.Order) > 0 {
+		order := args.Order
+		if len(args.Orders) > 0 {
+			if len(order) > 0 {
+				return nil, nil, ErrOrderAndOrders
+			}
+			order = make([]string, 0, len(args.Orders))
+			for _, o := range args.Orders {
+				order = append(order, o.String())
+			}
+		}
+		if len(order) > 0 {
 			queryParams = append(queryParams, QueryParam{
 				key:   "order",
-				value: strings.Join(args.Order, ","),
+				value: strings.Join(order, ","),
 			})
 		}
 		if len(args.Expand) > 0 {
@@ -288,33 +1065,542 @@ func (r *RecordApi[T]) List(args *ListArguments) (*ListResponse[T], error) {
 			})
 		}
 		for _, filter := range args.Filters {
-			queryParams = append(queryParams, filter.toParams("filter")...)
+			filterParams, err := filter.toParams("filter")
+			if err != nil {
+				return nil, nil, err
+			}
+			queryParams = append(queryParams, filterParams...)
 		}
 	}
 
-	resp, err := r.client.do("GET", fmt.Sprintf("%s/%s", recordApi, r.name), nil, queryParams)
-	if err != nil {
-		return nil, err
+	var timeout time.Duration
+	if args != nil {
+		timeout = args.Timeout
 	}
-	respBody, err := io.ReadAll(resp.Body)
+	ctx, cancel := r.client.newRequestContextWithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := r.client.doWithContext(ctx, "GET", r.path(), nil, nil, queryParams)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
 	var listResponse ListResponse[T]
-	err = json.Unmarshal(respBody, &listResponse)
+	err = decodeBody(r.client.codec, resp.Body, &listResponse)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &listResponse, newResponseMeta(resp), nil
+}
+
+// ListChangedSince lists records whose unix timestamp column is at or after
+// since, in ascending order of column, for incremental sync. Additional
+// filters and the page limit may be passed via args. Args' Order and Orders are
+// ignored and replaced by the ascending order of column.
+//
+// It returns the largest timestamp seen, or since if there were no records,
+// to be passed as since to the next poll. Since the lower bound is inclusive,
+// records sharing the boundary timestamp are listed again by the next poll and
+// should be deduplicated by the caller, e.g. by id. Unlike an exclusive bound,
+// this doesn't miss records written within the same second after a poll.
+//
+// If a full page shares a single timestamp, the next poll would list the same
+// page again and never advance. In that case, all records with that timestamp
+// are listed, page by page using args' limit and overriding args' cursor and
+// offset, followed by a page of newer records. The response may thus hold more
+// records than the limit.
+func (r *RecordApi[T]) ListChangedSince(column string, since time.Time, args *ListArguments) (*ListResponse[T], time.Time, error) {
+	var listArgs ListArguments
+	if args != nil {
+		listArgs = *args
+	}
+	filters := slices.Clip(listArgs.Filters)
+	listArgs.Filters = append(filters, FilterColumn{
+		Column: column,
+		Op:     GreaterThanEqual,
+		Value:  formatUnixTime(since),
+	})
+	listArgs.Order = []string{"+" + column}
+	listArgs.Orders = nil
+
+	listResponse, err := r.List(&listArgs)
+	if err != nil {
+		return nil, since, err
+	}
+	timestamps, err := r.unixTimeFields(listResponse.Records, column)
+	if err != nil {
+		return nil, since, err
+	}
+
+	n := len(timestamps)
+	if n > 0 && uint64(n) >= r.client.pageLimit(listArgs.Limit) && timestamps[0].Equal(timestamps[n-1]) {
+		stalled := timestamps[0]
+
+		// List the records with the stalled timestamp by offset, re-listing the
+		// first page for consistent ordering among them.
+		listArgs.Cursor = nil
+		listArgs.Filters = append(filters, FilterColumn{Column: column, Op: Equal, Value: formatUnixTime(stalled)})
+		var records []T
+		for {
+			offset := uint64(len(records))
+			listArgs.Offset = &offset
+			page, err := r.List(&listArgs)
+			if err != nil {
+				return nil, since, err
+			}
+			records = append(records, page.Records...)
+			if len(page.Records) == 0 || uint64(len(page.Records)) < r.client.pageLimit(listArgs.Limit) {
+				break
+			}
+		}
+
+		listArgs.Offset = nil
+		listArgs.Filters = append(filters, FilterColumn{Column: column, Op: GreaterThan, Value: formatUnixTime(stalled)})
+		newer, err := r.List(&listArgs)
+		if err != nil {
+			return nil, since, err
+		}
+		newerTimestamps, err := r.unixTimeFields(newer.Records, column)
+		if err != nil {
+			return nil, since, err
+		}
+
+		listResponse = &ListResponse[T]{Records: append(records, newer.Records...)}
+		timestamps = append([]time.Time{stalled}, newerTimestamps...)
+	}
+
+	latest := since
+	for _, t := range timestamps {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return listResponse, latest, nil
+}
+
+// unixTimeFields extracts column, holding unix seconds, from records.
+func (r *RecordApi[T]) unixTimeFields(records []T, column string) ([]time.Time, error) {
+	timestamps := make([]time.Time, len(records))
+	for i, record := range records {
+		t, err := r.unixTimeField(record, column)
+		if err != nil {
+			return nil, err
+		}
+		timestamps[i] = t
+	}
+	return timestamps, nil
+}
+
+// unixTimeField extracts column, holding unix seconds, from record.
+func (r *RecordApi[T]) unixTimeField(record T, column string) (time.Time, error) {
+	encoded, err := r.client.codec.Marshal(record)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return time.Time{}, err
+	}
+	raw, ok := fields[column]
+	if !ok {
+		return time.Time{}, fmt.Errorf("record has no field %q", column)
+	}
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err != nil {
+		return time.Time{}, fmt.Errorf("field %q: %w", column, err)
+	}
+	return time.Unix(int64(seconds), 0), nil
+}
+
+// SchemaMismatchError is returned by ValidateSchema for record fields that
+// don't correspond to any of the record API's columns.
+type SchemaMismatchError struct {
+	// Fields are descriptions of the mismatching Go struct fields.
+	Fields []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("SchemaMismatchError(%s)", strings.Join(e.Fields, ", "))
+}
+
+// ValidateSchema checks that the json names of T's fields match the record
+// API's columns, e.g. at startup to catch misspelled or missing json tags,
+// which otherwise silently result in empty fields. Unexported fields, which
+// encoding/json ignores, are skipped; go vet reports those with a json tag.
+// Validation requires the SCHEMA permission on the record API and is skipped
+// for non-struct records, e.g. DynamicRecord.
+func (r *RecordApi[T]) ValidateSchema(ctx context.Context) error {
+	ctx, cancel := r.client.newRequestContextFrom(ctx)
+	defer cancel()
+
+	queryParams := []QueryParam{{key: "mode", value: "Select"}}
+	resp, err := r.client.doWithContext(ctx, "GET", r.path()+"/schema", nil, nil, queryParams)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := decodeBody(r.client.codec, resp.Body, &schema); err != nil {
+		return err
+	}
+
+	recordType := reflect.TypeFor[T]()
+	for recordType.Kind() == reflect.Pointer {
+		recordType = recordType.Elem()
+	}
+	if recordType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var mismatches []string
+	for _, field := range reflect.VisibleFields(recordType) {
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			// Embedded struct, whose fields are visited separately.
+			if t := field.Type; t.Kind() == reflect.Struct || (t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct) {
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: no column %q", field.Name, name))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &SchemaMismatchError{Fields: mismatches}
+	}
+	return nil
+}
+
+// FilterError is returned by ValidateFilters when the server rejects the
+// filters with 400 Bad Request, e.g. because they refer to an unknown column
+// or the value cannot be converted to the column's type.
+type FilterError struct {
+	*FetchError
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("FilterError(%s)", e.FetchError)
+}
+
+func (e *FilterError) Unwrap() error {
+	return e.FetchError
+}
+
+// ValidateFilters checks that the server accepts filters without listing
+// more than a single record, e.g. as a pre-flight check in a query builder.
+func (r *RecordApi[T]) ValidateFilters(ctx context.Context, filters []Filter) error {
+	limit := uint64(0)
+	_, _, err := r.listWithContext(ctx, &ListArguments{
+		Filters:    filters,
+		Pagination: Pagination{Limit: &limit},
+	})
+
+	var ferr *FetchError
+	if errors.As(err, &ferr) && ferr.StatusCode == http.StatusBadRequest {
+		return &FilterError{FetchError: ferr}
+	}
+	return err
+}
+
+// Pager iterates over a list's pages by following the server's cursors, or
+// offsets where the server provides no cursor.
+type Pager[T any] struct {
+	api        *RecordApi[T]
+	args       ListArguments
+	totalCount *int64
+	done       bool
+}
+
+// Pages returns a Pager listing the records matching args page by page. If
+// args.Count is set, the total count is only requested with the first page
+// and remains available from TotalCount for the whole iteration.
+func (r *RecordApi[T]) Pages(args *ListArguments) *Pager[T] {
+	pager := &Pager[T]{api: r}
+	if args != nil {
+		pager.args = *args
+	}
+	return pager
+}
+
+// Next fetches the next page. It returns nil once all records have been
+// listed, after which Done reports true. The end is detected by an empty page,
+// see ListResponse.HasMore, or a page shorter than an explicit
+// Pagination.Limit, which saves the final request.
+func (p *Pager[T]) Next() (*ListResponse[T], error) {
+	return p.nextWithContext(context.Background())
+}
+
+func (p *Pager[T]) nextWithContext(ctx context.Context) (*ListResponse[T], error) {
+	if p.done {
+		return nil, nil
+	}
+
+	page, _, err := p.api.listWithContext(ctx, &p.args)
 	if err != nil {
 		return nil, err
 	}
 
-	return &listResponse, nil
+	if page.TotalCount != nil && p.totalCount == nil {
+		p.totalCount = page.TotalCount
+	}
+	page.TotalCount = p.totalCount
+
+	// Subsequent pages continue from the cursor and don't need the count
+	// again. The server only hands out cursors when ordering by primary key,
+	// otherwise continue by offset.
+	p.args.Count = false
+	p.args.Cursor = page.Cursor
+	if !page.Cursor.IsEmpty() {
+		p.args.Offset = nil
+	} else {
+		offset := uint64(len(page.Records))
+		if p.args.Offset != nil {
+			offset += *p.args.Offset
+		}
+		p.args.Offset = &offset
+	}
+
+	short := p.args.Limit != nil && uint64(len(page.Records)) < p.api.client.pageLimit(p.args.Limit)
+	if !page.HasMore() || short {
+		p.done = true
+	}
+	if len(page.Records) == 0 {
+		return nil, nil
+	}
+	return page, nil
+}
+
+// Done reports whether all pages have been fetched.
+func (p *Pager[T]) Done() bool {
+	return p.done
+}
+
+// TotalCount returns the total number of matching records as reported with
+// the first page, or nil if it wasn't requested or no page was fetched yet.
+func (p *Pager[T]) TotalCount() *int64 {
+	return p.totalCount
+}
+
+// PrefetchPager is a Pager fetching the following page in the background while
+// the current one is being processed, such that Next returns immediately if
+// the caller is slower than the server. Like Pager, it is not meant for
+// concurrent use. Close must be called to abandon an iteration early.
+type PrefetchPager[T any] struct {
+	pager  *Pager[T]
+	ctx    context.Context
+	cancel context.CancelFunc
+	// next is the result of the in-flight or completed fetch, nil if none was
+	// started. Buffered, such that the fetching goroutine never blocks.
+	next chan pageResult[T]
+}
+
+type pageResult[T any] struct {
+	page *ListResponse[T]
+	err  error
+}
+
+// PagesWithPrefetch is like Pages but prefetches the next page, see
+// PrefetchPager.
+func (r *RecordApi[T]) PagesWithPrefetch(args *ListArguments) *PrefetchPager[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PrefetchPager[T]{
+		pager:  r.Pages(args),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (p *PrefetchPager[T]) fetch() {
+	next := make(chan pageResult[T], 1)
+	p.next = next
+	go func() {
+		page, err := p.pager.nextWithContext(p.ctx)
+		next <- pageResult[T]{page: page, err: err}
+	}()
+}
+
+// Next returns the records of the next page and true, or false once all
+// records have been listed. ctx only bounds the wait, a fetch in flight is
+// kept for the next call. Fetches themselves are bound to the pager's
+// lifetime, i.e. canceled by Close.
+func (p *PrefetchPager[T]) Next(ctx context.Context) ([]T, bool, error) {
+	if err := p.ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	if p.next == nil {
+		if p.pager.Done() {
+			return nil, false, nil
+		}
+		p.fetch()
+	}
+
+	var result pageResult[T]
+	select {
+	case result = <-p.next:
+		p.next = nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+
+	if result.err != nil {
+		return nil, false, result.err
+	}
+	if result.page == nil {
+		return nil, false, nil
+	}
+	if !p.pager.Done() {
+		p.fetch()
+	}
+	return result.page.Records, true, nil
+}
+
+// Close cancels a prefetch in flight and waits for it to finish. Subsequent
+// calls to Next fail with context.Canceled.
+func (p *PrefetchPager[T]) Close() {
+	p.cancel()
+	if p.next != nil {
+		<-p.next
+		p.next = nil
+	}
+}
+
+// ExportJSONL writes all records matching args to w, one JSON object per line,
+// e.g. to back up a table. Records are fetched page by page, see Pages, so
+// memory use does not grow with the size of the table. It returns the number
+// of records written.
+func (r *RecordApi[T]) ExportJSONL(ctx context.Context, w io.Writer, args *ListArguments) (int64, error) {
+	var count int64
+	pager := r.Pages(args)
+	for !pager.Done() {
+		page, err := pager.nextWithContext(ctx)
+		if err != nil {
+			return count, err
+		}
+		if page == nil {
+			break
+		}
+
+		for _, record := range page.Records {
+			line, err := r.client.codec.Marshal(record)
+			if err != nil {
+				return count, err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
 }
 
 func NewRecordApi[T any](c *Client, name string) *RecordApi[T] {
+	if c.strictStructValidation {
+		logger := c.debugLogger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		for _, warning := range recordTypeWarnings(reflect.TypeFor[T]()) {
+			logger.Warn("questionable record type", "api", name, "type", reflect.TypeFor[T]().String(), "warning", warning)
+		}
+	}
 	return &RecordApi[T]{
 		client: c,
 		name:   name,
 	}
 }
 
+// recordTypeWarnings reports mistakes in a record type that result in fields
+// silently not being (de)serialized.
+func recordTypeWarnings(recordType reflect.Type) []string {
+	for recordType.Kind() == reflect.Pointer {
+		recordType = recordType.Elem()
+	}
+	if recordType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var warnings []string
+	serialized := 0
+	for _, field := range reflect.VisibleFields(recordType) {
+		tag, hasTag := field.Tag.Lookup("json")
+		switch {
+		case field.Anonymous || tag == "-":
+		case !field.IsExported():
+			if hasTag {
+				warnings = append(warnings, fmt.Sprintf("field %s has a json tag but is unexported and thus ignored", field.Name))
+			}
+		default:
+			serialized++
+		}
+	}
+	if serialized == 0 {
+		warnings = append(warnings, "no exported fields, records will always be empty")
+	}
+	return warnings
+}
+
+// DynamicRecord is a record of unknown schema. Numbers are decoded as
+// json.Number rather than float64, which cannot represent integers beyond 2^53
+// exactly, e.g. 64-bit ids.
+type DynamicRecord map[string]any
+
+func (r *DynamicRecord) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var record map[string]any
+	if err := decoder.Decode(&record); err != nil {
+		return err
+	}
+	*r = record
+	return nil
+}
+
+// NewDynamicRecordApi returns a record API for accessing records without
+// declaring a Go type for them, e.g. for admin tooling where the schema is
+// not known at compile time.
+func NewDynamicRecordApi(c *Client, name string) *RecordApi[DynamicRecord] {
+	return NewRecordApi[DynamicRecord](c, name)
+}
+
 const recordApi string = "api/records/v1"
+
+// path returns the API's path. Like record ids, the name is escaped, since
+// paths passed to Transport.Do are escaped paths.
+func (r *RecordApi[T]) path() string {
+	return r.client.recordApiPath + "/" + escapePathSegment(r.name)
+}
+
+// recordPath returns the path of the record with the given id. Ids may contain
+// arbitrary characters, e.g. "/" or "?" in TEXT primary keys.
+func (r *RecordApi[T]) recordPath(id RecordId) string {
+	return r.path() + "/" + escapePathSegment(id.ToString())
+}
+
+// escapePathSegment is like url.PathEscape but additionally escapes the dot
+// segments "." and "..", which would otherwise be resolved when joining the
+// path onto the base URL, e.g. turning a record's path into its API's.
+func escapePathSegment(s string) string {
+	switch s {
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	default:
+		return url.PathEscape(s)
+	}
+}
@@ -1,8 +1,24 @@
 package trailbase
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func testEq[T comparable](a, b []T) bool {
@@ -17,11 +33,62 @@ func testEq[T comparable](a, b []T) bool {
 	return true
 }
 
+func TestParseRecordId(t *testing.T) {
+	// A uuid_v7 as generated by the server.
+	const hexId = "01890a5d-ac96-774b-bcce-b302099a8057"
+	id, err := ParseRecordId(hexId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid, ok := id.(UUIDRecordId)
+	if !ok {
+		t.Fatalf("expected UUIDRecordId, got: %T", id)
+	}
+	if uuid[6]>>4 != 7 {
+		t.Fatal("expected version 7, got:", uuid[6]>>4)
+	}
+	if uuid.String() != hexId {
+		t.Fatal("unexpected hex form:", uuid.String())
+	}
+
+	b64Id := uuid.ToString()
+	if b64Id != "AYkKXayWd0u8zrMCCZqAVw==" {
+		t.Fatal("unexpected base64 form:", b64Id)
+	}
+	if url.PathEscape(b64Id) != b64Id {
+		t.Fatal("expected URL-safe id, got:", b64Id)
+	}
+	roundTripped, err := ParseRecordId(b64Id)
+	if err != nil || roundTripped != id {
+		t.Fatal("round trip failed:", roundTripped, err)
+	}
+
+	for input, expected := range map[string]RecordId{
+		"42":                                   IntRecordId(42),
+		"-1":                                   IntRecordId(-1),
+		"some-text-id":                         StringRecordId("some-text-id"),
+		"01890a5d-ac96-774b-bcce-b302099a805z": StringRecordId("01890a5d-ac96-774b-bcce-b302099a805z"),
+		"AYkKXayWd0u8zrMCCZqAVwxy":             StringRecordId("AYkKXayWd0u8zrMCCZqAVwxy"),
+	} {
+		id, err := ParseRecordId(input)
+		if err != nil || id != expected {
+			t.Errorf("%q: expected %#v, got: %#v, %v", input, expected, id, err)
+		}
+	}
+
+	if _, err := ParseRecordId(""); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func TestFilter(t *testing.T) {
-	got0 := FilterColumn{
+	got0, err := FilterColumn{
 		Column: "col",
 		Value:  "value",
 	}.toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
 	expected0 := []QueryParam{
 		{key: "filter[col]", value: "value"},
 	}
@@ -29,7 +96,7 @@ func TestFilter(t *testing.T) {
 		t.Fatal("unexpected filter, got:", got0, " expected: ", expected0)
 	}
 
-	got1 := FilterAnd{
+	got1, err := FilterAnd{
 		filters: []Filter{
 			FilterColumn{
 				Column: "col0",
@@ -51,6 +118,9 @@ func TestFilter(t *testing.T) {
 			},
 		},
 	}.toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
 	expected1 := []QueryParam{
 		{key: "filter[$and][0][col0]", value: "val0"},
 		{key: "filter[$and][1][$or][0][col1][$ne]", value: "val1"},
@@ -62,8 +132,140 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+func TestTopLevelCompositeFilters(t *testing.T) {
+	a := FilterColumn{Column: "a", Value: "1"}
+	b := FilterColumn{Column: "b", Op: GreaterThan, Value: "2"}
+	c := FilterColumn{Column: "c", Value: "3"}
+
+	// (a OR b) AND c
+	filters := []Filter{Or(a, b), c}
+	got := []QueryParam{}
+	for _, filter := range filters {
+		params, err := filter.toParams("filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, params...)
+	}
+	want := []QueryParam{
+		{key: "filter[$or][0][a]", value: "1"},
+		{key: "filter[$or][1][b][$gt]", value: "2"},
+		{key: "filter[c]", value: "3"},
+	}
+	if !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Top-level OR.
+	got, err := Or(a, And(b, c)).toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []QueryParam{
+		{key: "filter[$or][0][a]", value: "1"},
+		{key: "filter[$or][1][$and][0][b][$gt]", value: "2"},
+		{key: "filter[$or][1][$and][1][c]", value: "3"},
+	}
+	if !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFilterBetween(t *testing.T) {
+	got, err := FilterBetween{Column: "col", Low: "1", High: "10"}.toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []QueryParam{
+		{key: "filter[col][$gte]", value: "1"},
+		{key: "filter[col][$lte]", value: "10"},
+	}
+	if !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got, err = FilterBetween{Column: "col", Low: "1", High: "10", ExclusiveLow: true}.toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []QueryParam{
+		{key: "filter[col][$gt]", value: "1"},
+		{key: "filter[col][$lte]", value: "10"},
+	}
+	if !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got, err = FilterBetween{Column: "col", Low: "1", High: "10", ExclusiveLow: true, ExclusiveHigh: true}.toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same as spelling out both bounds as separate filters.
+	low, _ := FilterColumn{Column: "col", Op: GreaterThan, Value: "1"}.toParams("filter")
+	high, _ := FilterColumn{Column: "col", Op: LessThan, Value: "10"}.toParams("filter")
+	if want = append(low, high...); !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got, err = Or(FilterBetween{Column: "col", Low: "a", High: "b"}).toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []QueryParam{
+		{key: "filter[$or][0][col][$gte]", value: "a"},
+		{key: "filter[$or][0][col][$lte]", value: "b"},
+	}
+	if !testEq(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCompareOpAliases(t *testing.T) {
+	for _, op := range []CompareOp{LessThanEqual, LessThanOrEqual, GreaterThanEqual, GreaterThanOrEqual} {
+		if _, err := op.toString(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gte, _ := GreaterThanOrEqual.toString()
+	lte, _ := LessThanOrEqual.toString()
+	if gte != "$gte" || lte != "$lte" {
+		t.Fatal("unexpected ops:", gte, lte)
+	}
+}
+
+func TestFilterTimeHelpers(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Same instant as 2020-01-02 00:00:00 UTC, just in a different zone.
+	to := time.Date(2020, 1, 1, 19, 0, 0, 500, time.FixedZone("EST", -5*3600))
+
+	tests := []struct {
+		got  Filter
+		want []QueryParam
+	}{
+		{AfterTime("created", from), []QueryParam{{key: "filter[created][$gt]", value: "1577836800"}}},
+		{BeforeTime("created", to), []QueryParam{{key: "filter[created][$lt]", value: "1577923200"}}},
+		{BetweenTime("created", from, to), []QueryParam{
+			{key: "filter[created][$gte]", value: "1577836800"},
+			{key: "filter[created][$lte]", value: "1577923200"},
+		}},
+	}
+
+	for _, test := range tests {
+		got, err := test.got.toParams("filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !testEq(got, test.want) {
+			t.Fatalf("got %v, want %v", got, test.want)
+		}
+	}
+}
+
 func TestFilterIsNullToParams(t *testing.T) {
-	got := IsNullFilter("col0").toParams("filter")
+	got, err := IsNullFilter("col0").toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
 	want := []QueryParam{{key: "filter[col0][$is]", value: "NULL"}}
 	if !testEq(got, want) {
 		t.Fatalf("got %v, want %v", got, want)
@@ -71,13 +273,84 @@ func TestFilterIsNullToParams(t *testing.T) {
 }
 
 func TestFilterIsNotNullToParams(t *testing.T) {
-	got := IsNotNullFilter("col0").toParams("filter")
+	got, err := IsNotNullFilter("col0").toParams("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
 	want := []QueryParam{{key: "filter[col0][$is]", value: "!NULL"}}
 	if !testEq(got, want) {
 		t.Fatalf("got %v, want %v", got, want)
 	}
 }
 
+func TestCompareOpToString(t *testing.T) {
+	// Must match the operators accepted by the server's query parser.
+	expected := map[CompareOp]string{
+		Equal:            "$eq",
+		NotEqual:         "$ne",
+		LessThan:         "$lt",
+		LessThanEqual:    "$lte",
+		GreaterThan:      "$gt",
+		GreaterThanEqual: "$gte",
+		Like:             "$like",
+		Regex:            "$re",
+		StWithin:         "@within",
+		StIntersects:     "@intersects",
+		StContains:       "@contains",
+		IsNull:           "$is",
+		IsNotNull:        "$is",
+	}
+
+	for op, want := range expected {
+		got, err := op.toString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("op %d: got %s, want %s", op, got, want)
+		}
+	}
+}
+
+func TestFilterUnknownOp(t *testing.T) {
+	_, err := FilterAnd{
+		filters: []Filter{
+			FilterColumn{Column: "col0", Op: CompareOp(999), Value: "val0"},
+		},
+	}.toParams("filter")
+	if err == nil {
+		t.Fatal("expected error for unknown operation")
+	}
+
+	if _, err := Undefined.toString(); err == nil {
+		t.Fatal("expected error for undefined operation")
+	}
+}
+
+func TestFilterLikeHelpers(t *testing.T) {
+	tests := []struct {
+		got  FilterColumn
+		want QueryParam
+	}{
+		{Contains("col", "foo"), QueryParam{key: "filter[col][$like]", value: "%foo%"}},
+		{Contains("col", "50%"), QueryParam{key: "filter[col][$like]", value: `%50\%%`}},
+		{StartsWith("col", "a_b"), QueryParam{key: "filter[col][$like]", value: `a\_b%`}},
+		{EndsWith("col", `C:\dir`), QueryParam{key: "filter[col][$like]", value: `%C:\\dir`}},
+		{Contains("col", `%_\`), QueryParam{key: "filter[col][$like]", value: `%\%\_\\%`}},
+	}
+
+	for _, test := range tests {
+		got, err := test.got.toParams("filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []QueryParam{test.want}
+		if !testEq(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
 func TestEventParsing(t *testing.T) {
 	{
 		errJson := `
@@ -158,3 +431,1498 @@ func TestEventParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestLargeIntegerIds(t *testing.T) {
+	const largeId = "9007199254740993"
+
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if r.Method == "POST" {
+			w.Write([]byte(`{"ids": ["` + largeId + `"]}`))
+			return
+		}
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	id, err := api.Create(SimpleStrict{TextNotNull: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ToString() != largeId {
+		t.Fatal("expected", largeId, "got", id.ToString())
+	}
+
+	_, err = api.Read(IntRecordId(9007199254740993))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/records/v1/simple_strict_table/" + largeId; gotPath != want {
+		t.Fatal("expected", want, "got", gotPath)
+	}
+
+	insertEvent, err := parseEvent([]byte(`data: {"Insert": {"id": ` + largeId + `}, "seq": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := *insertEvent.Value.Value()
+	if got := value["id"].(json.Number).String(); got != largeId {
+		t.Fatal("expected", largeId, "got", got)
+	}
+}
+
+func TestDecodeChangeEvent(t *testing.T) {
+	client, err := NewClient("http://localhost:4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	for _, tc := range []struct {
+		data     string
+		expected EventType
+	}{
+		{`data: {"Insert": {"id": "AYkKXayWd0u8zrMCCZqAVw==", "text_not_null": "a"}, "seq": 1}`, EventInsert},
+		{`data: {"Update": {"id": "AYkKXayWd0u8zrMCCZqAVw==", "text_not_null": "b"}, "seq": 2}`, EventUpdate},
+		{`data: {"Delete": {"id": "AYkKXayWd0u8zrMCCZqAVw==", "text_not_null": "b"}, "seq": 3}`, EventDelete},
+	} {
+		event, err := parseEvent([]byte(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		change, err := api.DecodeChangeEvent(*event, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change.Type != tc.expected || change.Seq == nil || change.Record == nil || change.Record.TextNotNull == "" {
+			t.Fatal("unexpected change:", change)
+		}
+		if id, ok := change.Id.(UUIDRecordId); !ok || id.String() != "01890a5d-ac96-774b-bcce-b302099a8057" {
+			t.Fatal("unexpected id:", change.Id)
+		}
+	}
+
+	// Large integer ids are preserved.
+	event, err := parseEvent([]byte(`data: {"Insert": {"id": 9007199254740993, "text_not_null": "a"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type IntRecord struct {
+		Id int64 `json:"id"`
+	}
+	intChange, err := NewRecordApi[IntRecord](client, "int_table").DecodeChangeEvent(*event, "id")
+	if err != nil || intChange.Id != IntRecordId(9007199254740993) || intChange.Record.Id != 9007199254740993 {
+		t.Fatal("unexpected change:", intChange, err)
+	}
+
+	event, err = parseEvent([]byte(`data: {"Error": {"status": 1, "message": "forbidden"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eerr *ErrorEvent
+	if _, err := api.DecodeChangeEvent(*event, "id"); !errors.As(err, &eerr) || eerr.Status != 1 {
+		t.Fatal("expected error event, got:", err)
+	}
+}
+
+func TestReadWithMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	record, meta, err := api.ReadWithMeta(StringRecordId("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.TextNotNull != "test" {
+		t.Fatal("unexpected record:", record)
+	}
+	if meta.StatusCode != 200 || meta.Header.Get("ETag") != `"v1"` {
+		t.Fatal("unexpected meta:", meta)
+	}
+}
+
+func TestDynamicRecordApi(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/records/v1/simple_strict_table" {
+			w.Write([]byte(`{"records": [{"id": 1, "text_not_null": "a"}, {"id": 2, "text_not_null": "b"}]}`))
+			return
+		}
+		w.Write([]byte(`{"id": 9007199254740993, "text_not_null": "a", "nested": {"key": [1, 2]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewDynamicRecordApi(client, "simple_strict_table")
+
+	record, err := api.Read(IntRecordId(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*record)["text_not_null"] != "a" {
+		t.Fatal("unexpected record:", record)
+	}
+	// 2^53 + 1 is not representable as float64.
+	if id, ok := (*record)["id"].(json.Number); !ok || id.String() != "9007199254740993" {
+		t.Fatal("unexpected id:", (*record)["id"])
+	}
+	if id, err := (*record)["id"].(json.Number).Int64(); err != nil || id != 9007199254740993 {
+		t.Fatal("unexpected id:", id, err)
+	}
+	if nested, ok := (*record)["nested"].(map[string]any); !ok || len(nested["key"].([]any)) != 2 || nested["key"].([]any)[1] != json.Number("2") {
+		t.Fatal("unexpected nested value:", (*record)["nested"])
+	}
+
+	list, err := api.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Records) != 2 || list.Records[1]["text_not_null"] != "b" {
+		t.Fatal("unexpected list:", list)
+	}
+}
+
+func TestCreateMultipart(t *testing.T) {
+	type Record struct {
+		Name     string         `json:"name"`
+		Count    int64          `json:"count"`
+		Enabled  bool           `json:"enabled"`
+		Optional *string        `json:"optional"`
+		Meta     map[string]int `json:"meta"`
+	}
+
+	var fields map[string][]string
+	var fileName, fileType, fileContent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields = r.MultipartForm.Value
+
+		file, header, err := r.FormFile("attachment")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		fileName, fileType, fileContent = header.Filename, header.Header.Get("Content-Type"), string(content)
+
+		w.Write([]byte(`{"ids": ["abc"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[Record](client, "records")
+
+	id, err := api.CreateMultipart(context.Background(), Record{
+		Name:    "test",
+		Count:   42,
+		Enabled: true,
+		Meta:    map[string]int{"a": 1},
+	}, map[string]FileUpload{
+		"attachment": {Filename: "notes.txt", ContentType: "text/plain", Content: strings.NewReader("hello")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ToString() != "abc" {
+		t.Fatal("unexpected id:", id)
+	}
+
+	want := map[string]string{"name": "test", "count": "42", "enabled": "1", "meta": `{"a":1}`}
+	if len(fields) != len(want) {
+		t.Fatalf("got fields %v, want %v", fields, want)
+	}
+	for name, value := range want {
+		if len(fields[name]) != 1 || fields[name][0] != value {
+			t.Fatalf("field %s: got %v, want %s", name, fields[name], value)
+		}
+	}
+	if fileName != "notes.txt" || fileType != "text/plain" || fileContent != "hello" {
+		t.Fatal("unexpected file:", fileName, fileType, fileContent)
+	}
+}
+
+// gatedReader blocks its first read until gate is closed.
+type gatedReader struct {
+	gate    <-chan struct{}
+	content io.Reader
+}
+
+func (r *gatedReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.gate:
+		return r.content.Read(p)
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("body was not streamed")
+	}
+}
+
+func TestCreateMultipartStreams(t *testing.T) {
+	// The file can only be read once the server received the request, i.e. the
+	// body must be sent while it is being written.
+	received := make(chan struct{})
+	var fileContent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+
+		file, _, err := r.FormFile("attachment")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		fileContent = string(content)
+
+		w.Write([]byte(`{"ids": ["abc"]}`))
+	}))
+	defer srv.Close()
+
+	var dump bytes.Buffer
+	client, err := NewClient(srv.URL, WithRequestDump(&dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "records")
+
+	_, err = api.CreateMultipart(context.Background(), SimpleStrict{TextNotNull: "test"}, map[string]FileUpload{
+		"attachment": {Filename: "notes.txt", Content: &gatedReader{gate: received, content: strings.NewReader("hello")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileContent != "hello" {
+		t.Fatal("unexpected file content:", fileContent)
+	}
+
+	// Streamed bodies are not dumped.
+	if got := dump.String(); !strings.Contains(got, "POST /api/records/v1/records") || strings.Contains(got, "hello") {
+		t.Fatalf("unexpected dump:\n%s", got)
+	}
+}
+
+func TestCreateMultipartFileError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"ids": ["abc"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "records")
+
+	readErr := errors.New("read failed")
+	_, err = api.CreateMultipart(context.Background(), SimpleStrict{TextNotNull: "test"}, map[string]FileUpload{
+		"attachment": {Filename: "notes.txt", Content: io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(readErr))},
+	})
+	if !errors.Is(err, readErr) {
+		t.Fatal("expected read error, got:", err)
+	}
+
+	// Bodies exceeding the limit are aborted while streaming.
+	client, err = NewClient(srv.URL, WithMaxRequestBodySize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api = NewRecordApi[SimpleStrict](client, "records")
+	_, err = api.CreateMultipart(context.Background(), SimpleStrict{TextNotNull: "test"}, map[string]FileUpload{
+		"attachment": {Filename: "large.bin", Content: bytes.NewReader(make([]byte, 4096))},
+	})
+	if !errors.Is(err, ErrRequestBodyTooLarge) {
+		t.Fatal("expected ErrRequestBodyTooLarge, got:", err)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			http.Error(w, "db constraint: not null", http.StatusBadRequest)
+		case "PATCH":
+			http.Error(w, "rejected", http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	var verr *ValidationError
+	_, err = api.Create(SimpleStrict{})
+	if !errors.As(err, &verr) || verr.Constraint != "not null" {
+		t.Fatal("expected not null violation, got:", err)
+	}
+	var ferr *FetchError
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected wrapped FetchError, got:", err)
+	}
+
+	err = api.Update(StringRecordId("1"), SimpleStrict{})
+	if !errors.As(err, &verr) || verr.Constraint != "" || strings.TrimSpace(verr.Message) != "rejected" {
+		t.Fatal("expected validation error without constraint, got:", err)
+	}
+
+	// Other errors are not validation errors.
+	err = api.Delete(StringRecordId("1"))
+	if errors.As(err, &verr) || !errors.As(err, &ferr) || ferr.StatusCode != http.StatusForbidden {
+		t.Fatal("expected plain FetchError, got:", err)
+	}
+}
+
+func TestEmptySuccessResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/records/v1/with_location":
+			w.Header().Set("Location", "/api/records/v1/with_location/new-id")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "POST" && r.URL.Path == "/api/records/v1/empty_ids":
+			w.Header().Set("Location", "https://example.com/api/records/v1/empty_ids/other%20id")
+			w.Write([]byte(`{"ids": []}`))
+		case r.Method == "POST":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewRecordApi[SimpleStrict](client, "with_location")
+	id, err := api.Create(SimpleStrict{TextNotNull: "test"})
+	if err != nil || id.ToString() != "new-id" {
+		t.Fatal("unexpected result:", id, err)
+	}
+	if err := api.Update(id, SimpleStrict{TextNotNull: "update"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err = NewRecordApi[SimpleStrict](client, "empty_ids").Create(SimpleStrict{TextNotNull: "test"})
+	if err != nil || id.ToString() != "other id" {
+		t.Fatal("unexpected result:", id, err)
+	}
+
+	_, err = NewRecordApi[SimpleStrict](client, "without_location").Create(SimpleStrict{TextNotNull: "test"})
+	if err == nil {
+		t.Fatal("expected error for empty response without Location")
+	}
+}
+
+func TestCreateMany(t *testing.T) {
+	var created []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var records []SimpleStrict
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &records); err != nil {
+			var record SimpleStrict
+			if err := json.Unmarshal(body, &record); err != nil {
+				http.Error(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+			records = []SimpleStrict{record}
+		}
+
+		// Emulate the server's transaction: reject all if any is invalid.
+		for _, record := range records {
+			if record.TextNotNull == "" {
+				http.Error(w, "db constraint: not null", http.StatusBadRequest)
+				return
+			}
+		}
+		ids := []string{}
+		for _, record := range records {
+			created = append(created, record.TextNotNull)
+			ids = append(ids, "id-"+record.TextNotNull)
+		}
+		json.NewEncoder(w).Encode(RecordIdResponse{Ids: ids})
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	records := []SimpleStrict{{TextNotNull: "a"}, {TextNotNull: ""}, {TextNotNull: "c"}}
+
+	var verr *ValidationError
+	ids, createErrors, err := api.CreateMany(records, nil)
+	if !errors.As(err, &verr) || verr.Constraint != "not null" || ids != nil || createErrors != nil {
+		t.Fatal("expected validation error, got:", ids, createErrors, err)
+	}
+	if len(created) != 0 {
+		t.Fatal("expected no records to be created, got:", created)
+	}
+
+	ids, createErrors, err = api.CreateMany(records, &CreateManyOptions{BestEffort: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0].ToString() != "id-a" || ids[1] != nil || ids[2].ToString() != "id-c" {
+		t.Fatal("unexpected ids:", ids)
+	}
+	if len(createErrors) != 1 || createErrors[0].Index != 1 || !errors.As(createErrors[0].Err, &verr) {
+		t.Fatal("unexpected errors:", createErrors)
+	}
+
+	ids, _, err = api.CreateMany(records[:1], nil)
+	if err != nil || len(ids) != 1 || ids[0].ToString() != "id-a" {
+		t.Fatal("unexpected result:", ids, err)
+	}
+}
+
+func TestCreateManyWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cancel while creating the second record.
+		if requests.Add(1) == 2 {
+			cancel()
+			// Consume the body for the server to notice the client going away.
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"ids": ["id"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	records := []SimpleStrict{{TextNotNull: "a"}, {TextNotNull: "b"}, {TextNotNull: "c"}}
+
+	ids, createErrors, err := api.CreateManyWithContext(ctx, records, &CreateManyOptions{BestEffort: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got:", err)
+	}
+	if len(ids) != 3 || ids[0] == nil || ids[1] != nil || ids[2] != nil || len(createErrors) != 0 {
+		t.Fatal("unexpected result:", ids, createErrors)
+	}
+	if requests.Load() != 2 {
+		t.Fatal("expected no requests after cancellation, got:", requests.Load())
+	}
+
+	// Transactional creation is bound to ctx as well.
+	if _, _, err := api.CreateManyWithContext(ctx, records, nil); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got:", err)
+	}
+}
+
+func TestImportJSONL(t *testing.T) {
+	var batches [][]SimpleStrict
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var records []SimpleStrict
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, records)
+
+		ids := []string{}
+		for _, record := range records {
+			ids = append(ids, "id-"+record.TextNotNull)
+		}
+		json.NewEncoder(w).Encode(RecordIdResponse{Ids: ids})
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	input := `{"text_not_null": "a"}
+{"text_not_null": "b"}
+
+{"text_not_null": "c"}
+{"text_not_null": "d"}
+{"text_not_null": "e"}`
+
+	progress := []int64{}
+	count, err := api.ImportJSONL(t.Context(), strings.NewReader(input), 2, func(imported int64) {
+		progress = append(progress, imported)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 || len(batches) != 3 || !testEq([]int64{2, 4, 5}, progress) {
+		t.Fatal("unexpected import:", count, batches, progress)
+	}
+
+	batches = nil
+	count, err = api.ImportJSONL(t.Context(), strings.NewReader("{\"text_not_null\": \"a\"}\n{\n"), 1, nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2") || count != 1 || len(batches) != 1 {
+		t.Fatal("expected decode error on line 2, got:", count, err)
+	}
+}
+
+func TestReadOptional(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/records/v1/simple_strict_table/found":
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		case "/api/records/v1/simple_strict_table/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			http.Error(w, "internal", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	record, found, err := api.ReadOptional(StringRecordId("found"))
+	if err != nil || !found || record.TextNotNull != "test" {
+		t.Fatal("unexpected result:", record, found, err)
+	}
+
+	record, found, err = api.ReadOptional(StringRecordId("missing"))
+	if err != nil || found || record != nil {
+		t.Fatal("unexpected result:", record, found, err)
+	}
+
+	var ferr *FetchError
+	_, found, err = api.ReadOptional(StringRecordId("other"))
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusInternalServerError || found {
+		t.Fatal("expected server error, got:", found, err)
+	}
+
+	unreachable, err := NewClient("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err = NewRecordApi[SimpleStrict](unreachable, "simple_strict_table").ReadOptional(StringRecordId("found"))
+	if err == nil || errors.As(err, &ferr) || found {
+		t.Fatal("expected transport error, got:", found, err)
+	}
+}
+
+func TestPager(t *testing.T) {
+	var requests []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requests = append(requests, query)
+		switch query.Get("cursor") {
+		case "":
+			w.Write([]byte(`{"records": [{"text_not_null": "a"}, {"text_not_null": "b"}], "cursor": "b", "total_count": 3}`))
+		case "b":
+			w.Write([]byte(`{"records": [{"text_not_null": "c"}], "cursor": "c"}`))
+		default:
+			http.Error(w, "unexpected cursor", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	limit := uint64(2)
+	pager := api.Pages(&ListArguments{
+		Count:      true,
+		Pagination: Pagination{Limit: &limit},
+	})
+
+	texts := []string{}
+	for !pager.Done() {
+		page, err := pager.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == nil {
+			break
+		}
+		if page.TotalCount == nil || *page.TotalCount != 3 {
+			t.Fatal("expected total count on every page, got:", page.TotalCount)
+		}
+		for _, record := range page.Records {
+			texts = append(texts, record.TextNotNull)
+		}
+	}
+
+	if !testEq([]string{"a", "b", "c"}, texts) {
+		t.Fatal("unexpected records:", texts)
+	}
+	if len(requests) != 2 {
+		t.Fatal("expected two requests, got:", requests)
+	}
+	if requests[0].Get("count") != "true" || requests[1].Has("count") {
+		t.Fatal("expected count to only be requested once, got:", requests)
+	}
+	if pager.TotalCount() == nil || *pager.TotalCount() != 3 {
+		t.Fatal("unexpected total count:", pager.TotalCount())
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursors = append(cursors, r.URL.Query().Get("cursor"))
+		if r.URL.Query().Has("cursor") {
+			w.Write([]byte(`{"records": []}`))
+			return
+		}
+		w.Write([]byte(`{"records": [{"text_not_null": "a"}], "cursor": "opaque+/="}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	first, err := api.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cursor.IsEmpty() || *first.Cursor != "opaque+/=" {
+		t.Fatal("unexpected cursor:", first.Cursor)
+	}
+
+	second, err := api.List(&ListArguments{Pagination: Pagination{Cursor: first.Cursor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Cursor.IsEmpty() {
+		t.Fatal("expected no cursor, got:", *second.Cursor)
+	}
+	if !testEq([]string{"", "opaque+/="}, cursors) {
+		t.Fatal("unexpected cursors:", cursors)
+	}
+
+	// An empty cursor is treated like none.
+	empty := Cursor("")
+	if _, err := api.List(&ListArguments{Pagination: Pagination{Cursor: &empty}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cursors) != 3 || cursors[2] != "" {
+		t.Fatal("unexpected cursors:", cursors)
+	}
+}
+
+// slowListTransport answers list requests with pages of a single record after
+// delay, continuing by offset until pages are exhausted.
+type slowListTransport struct {
+	base     *url.URL
+	delay    time.Duration
+	pages    int
+	requests atomic.Int64
+}
+
+func (t *slowListTransport) BaseUrl() *url.URL {
+	return t.base
+}
+
+func (t *slowListTransport) Get(u string) (*http.Response, error) {
+	return nil, errors.New("unexpected Get")
+}
+
+func (t *slowListTransport) Do(ctx context.Context, method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	t.requests.Add(1)
+	select {
+	case <-time.After(t.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	offset := 0
+	for _, param := range queryParams {
+		if param.key == "offset" {
+			offset, _ = strconv.Atoi(param.value)
+		}
+	}
+	records := "[]"
+	if offset < t.pages {
+		records = fmt.Sprintf(`[{"text_not_null": "%d"}]`, offset)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"records": ` + records + `}`))}, nil
+}
+
+func TestPrefetchPager(t *testing.T) {
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &slowListTransport{base: base, delay: 50 * time.Millisecond, pages: 3}
+	client, err := NewClient(base.String(), WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	pager := api.PagesWithPrefetch(nil)
+	defer pager.Close()
+
+	texts := []string{}
+	var waited []time.Duration
+	for {
+		start := time.Now()
+		records, ok, err := pager.Next(t.Context())
+		waited = append(waited, time.Since(start))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		for _, record := range records {
+			texts = append(texts, record.TextNotNull)
+		}
+		// Render the page while the next one is being fetched.
+		time.Sleep(2 * transport.delay)
+	}
+
+	if !testEq([]string{"0", "1", "2"}, texts) {
+		t.Fatal("unexpected records:", texts)
+	}
+	// Three pages plus the empty one terminating the iteration.
+	if n := transport.requests.Load(); n != 4 {
+		t.Fatal("unexpected number of requests:", n)
+	}
+	if waited[0] < transport.delay {
+		t.Fatal("expected first page to be fetched on demand, waited:", waited[0])
+	}
+	for _, w := range waited[1:] {
+		if w >= transport.delay/2 {
+			t.Fatal("expected prefetched pages, waited:", waited)
+		}
+	}
+}
+
+func TestPrefetchPagerClose(t *testing.T) {
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &slowListTransport{base: base, delay: time.Hour, pages: 3}
+	client, err := NewClient(base.String(), WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	pager := api.PagesWithPrefetch(nil)
+
+	// Give up waiting, which leaves the fetch in flight.
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := pager.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded, got:", err)
+	}
+
+	// Close cancels the fetch and only returns once it finished.
+	done := make(chan struct{})
+	go func() {
+		pager.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not cancel the fetch in flight")
+	}
+
+	if _, ok, err := pager.Next(t.Context()); ok || !errors.Is(err, context.Canceled) {
+		t.Fatal("expected canceled pager, got:", ok, err)
+	}
+}
+
+func TestListResponseHasMore(t *testing.T) {
+	cursor := Cursor("last")
+	for _, tc := range []struct {
+		page    ListResponse[SimpleStrict]
+		hasMore bool
+	}{
+		{ListResponse[SimpleStrict]{}, false},
+		// Offset-paginated, e.g. views, never have a cursor.
+		{ListResponse[SimpleStrict]{Records: []SimpleStrict{{}}}, true},
+		// The last non-empty page of a table still has a cursor.
+		{ListResponse[SimpleStrict]{Records: []SimpleStrict{{}}, Cursor: &cursor}, true},
+	} {
+		if tc.page.HasMore() != tc.hasMore {
+			t.Fatal("unexpected HasMore for:", tc.page)
+		}
+	}
+}
+
+func TestPagerOffset(t *testing.T) {
+	var offsets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset := r.URL.Query().Get("offset")
+		offsets = append(offsets, offset)
+		switch offset {
+		case "1":
+			w.Write([]byte(`{"records": [{"text_not_null": "b"}, {"text_not_null": "a"}]}`))
+		case "3":
+			w.Write([]byte(`{"records": []}`))
+		default:
+			http.Error(w, "unexpected offset", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	offset := uint64(1)
+	pager := api.Pages(&ListArguments{
+		Order:      []string{"-text_not_null"},
+		Pagination: Pagination{Offset: &offset},
+	})
+
+	texts := []string{}
+	for !pager.Done() {
+		page, err := pager.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == nil {
+			break
+		}
+		for _, record := range page.Records {
+			texts = append(texts, record.TextNotNull)
+		}
+	}
+
+	if !testEq([]string{"b", "a"}, texts) || !testEq([]string{"1", "3"}, offsets) {
+		t.Fatal("unexpected result:", texts, offsets)
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	orders := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orders = append(orders, r.URL.Query().Get("order"))
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	if _, err := api.List(&ListArguments{Order: []string{"-year", "+name"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.List(&ListArguments{Orders: []Order{{Column: "year", Desc: true}, {Column: "name"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if !testEq([]string{"-year,+name", "-year,+name"}, orders) {
+		t.Fatal("unexpected orders:", orders)
+	}
+
+	_, err = api.List(&ListArguments{Order: []string{"-year"}, Orders: []Order{{Column: "name"}}})
+	if !errors.Is(err, ErrOrderAndOrders) {
+		t.Fatal("expected ErrOrderAndOrders, got:", err)
+	}
+	if len(orders) != 2 {
+		t.Fatal("unexpected request")
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	limits := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits = append(limits, r.URL.Query().Get("limit"))
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithMaxPageLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	small, huge := uint64(10), uint64(5000)
+	for _, limit := range []*uint64{nil, &small, &huge} {
+		if _, err := api.List(&ListArguments{Pagination: Pagination{Limit: limit}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !testEq([]string{"50", "10", "100"}, limits) {
+		t.Fatal("unexpected limits:", limits)
+	}
+
+	cursor := Cursor("abc")
+	_, err = api.List(&ListArguments{Pagination: Pagination{Cursor: &cursor, Offset: &small}})
+	if !errors.Is(err, ErrCursorAndOffset) {
+		t.Fatal("expected ErrCursorAndOffset, got:", err)
+	}
+	if len(limits) != 3 {
+		t.Fatal("unexpected request")
+	}
+}
+
+func TestListChangedSince(t *testing.T) {
+	type Message struct {
+		Id      string `json:"id"`
+		Updated int64  `json:"updated"`
+	}
+
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("filter[updated][$gte]") == "1577836900" {
+			w.Write([]byte(`{"records": []}`))
+			return
+		}
+		w.Write([]byte(`{"records": [{"id": "a", "updated": 1577836800}, {"id": "b", "updated": 1577836900}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[Message](client, "messages")
+
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := uint64(10)
+	filters := []Filter{FilterColumn{Column: "room", Value: "1"}}
+	resp, latest, err := api.ListChangedSince("updated", since, &ListArguments{
+		Order:      []string{"-id"},
+		Filters:    filters,
+		Pagination: Pagination{Limit: &limit},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Records) != 2 || latest.Unix() != 1577836900 {
+		t.Fatal("unexpected result:", resp, latest)
+	}
+	if query.Get("filter[updated][$gte]") != "1577836800" || query.Get("order") != "+updated" ||
+		query.Get("filter[room]") != "1" || query.Get("limit") != "10" {
+		t.Fatal("unexpected query:", query)
+	}
+	if len(filters) != 1 {
+		t.Fatal("caller's filters were modified:", filters)
+	}
+
+	resp, next, err := api.ListChangedSince("updated", latest, nil)
+	if err != nil || len(resp.Records) != 0 || !next.Equal(latest) {
+		t.Fatal("unexpected result:", resp, next, err)
+	}
+}
+
+func TestListChangedSinceSharedTimestamp(t *testing.T) {
+	type Message struct {
+		Id      string `json:"id"`
+		Updated int64  `json:"updated"`
+	}
+	messages := []Message{{"a", 100}, {"b", 100}, {"c", 100}, {"d", 200}, {"e", 300}}
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		if query.Get("order") != "+updated" {
+			http.Error(w, "unexpected order", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+
+		var matching []Message
+		for _, m := range messages {
+			updated := strconv.FormatInt(m.Updated, 10)
+			if v := query.Get("filter[updated][$gte]"); v != "" && updated < v {
+				continue
+			}
+			if v := query.Get("filter[updated][$gt]"); v != "" && updated <= v {
+				continue
+			}
+			if v := query.Get("filter[updated][$eq]"); v != "" && updated != v {
+				continue
+			}
+			matching = append(matching, m)
+		}
+		matching = matching[min(offset, len(matching)):]
+		json.NewEncoder(w).Encode(ListResponse[Message]{Records: matching[:min(limit, len(matching))]})
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[Message](client, "messages")
+
+	// All records of the first page share one timestamp, which would stall a
+	// sync loop.
+	limit := uint64(2)
+	var ids []string
+	since := time.Unix(0, 0)
+	for range 3 {
+		resp, latest, err := api.ListChangedSince("updated", since, &ListArguments{Pagination: Pagination{Limit: &limit}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range resp.Records {
+			if !slices.Contains(ids, m.Id) {
+				ids = append(ids, m.Id)
+			}
+		}
+		since = latest
+	}
+	if !testEq(ids, []string{"a", "b", "c", "d", "e"}) || since.Unix() != 300 {
+		t.Fatal("unexpected result:", ids, since)
+	}
+	// The stalled page, the records at 100 in two pages and a page of newer
+	// records, followed by two regular polls.
+	if requests != 6 {
+		t.Fatal("unexpected number of requests:", requests)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/records/v1/movies/schema" || r.URL.Query().Get("mode") != "Select" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"title": "movies", "type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}, "year": {"type": "integer"}}, "required": ["id", "name"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Base struct {
+		Id int64 `json:"id"`
+	}
+	type Movie struct {
+		Base
+		Name    string `json:"name"`
+		Ignored string `json:"-"`
+	}
+	if err := NewRecordApi[Movie](client, "movies").ValidateSchema(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDynamicRecordApi(client, "movies").ValidateSchema(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	type BrokenMovie struct {
+		Id    int64  `json:"id"`
+		Title string `json:"title"`
+		Year  int
+	}
+	var serr *SchemaMismatchError
+	err = NewRecordApi[BrokenMovie](client, "movies").ValidateSchema(t.Context())
+	if !errors.As(err, &serr) || len(serr.Fields) != 2 {
+		t.Fatal("expected two mismatches, got:", err)
+	}
+
+	var ferr *FetchError
+	err = NewRecordApi[Movie](client, "unknown").ValidateSchema(t.Context())
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusNotFound {
+		t.Fatal("expected not found, got:", err)
+	}
+}
+
+func TestStrictStructValidation(t *testing.T) {
+	var logs bytes.Buffer
+	client, err := NewClient("http://localhost:4000", WithStrictStructValidation(), WithDebugLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Movie struct {
+		Id      int64  `json:"id"`
+		Name    string `json:"name"`
+		Ignored string `json:"-"`
+		private int
+	}
+	NewRecordApi[Movie](client, "movies")
+	NewDynamicRecordApi(client, "movies")
+	if logs.Len() != 0 {
+		t.Fatal("unexpected warnings:", logs.String())
+	}
+
+	// Like a struct with `json:"name"` tagged unexported fields, which vet
+	// rejects in this package.
+	type BrokenMovie struct {
+		name string
+	}
+	NewRecordApi[BrokenMovie](client, "movies")
+	if !strings.Contains(logs.String(), "no exported fields") {
+		t.Fatal("expected warning, got:", logs.String())
+	}
+
+	if warnings := recordTypeWarnings(reflect.TypeFor[*Movie]()); len(warnings) != 0 {
+		t.Fatal("unexpected warnings:", warnings)
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("limit") != "0" {
+			http.Error(w, "unexpected limit", http.StatusInternalServerError)
+			return
+		}
+		if query.Has("filter[unknown]") {
+			http.Error(w, "Invalid filter params", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"records": [{"text_not_null": "a"}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	if err := api.ValidateFilters(t.Context(), []Filter{FilterColumn{Column: "text_not_null", Value: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ferr *FilterError
+	err = api.ValidateFilters(t.Context(), []Filter{FilterColumn{Column: "unknown", Value: "a"}})
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected filter error, got:", err)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"records": [{"text_not_null": "a"}, {"text_not_null": "b"}], "cursor": "b"}`))
+		case "b":
+			w.Write([]byte(`{"records": [{"text_not_null": "c"}], "cursor": "c"}`))
+		default:
+			w.Write([]byte(`{"records": []}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	var buf bytes.Buffer
+	count, err := api.ExportJSONL(t.Context(), &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if count != 3 || len(lines) != 3 {
+		t.Fatal("unexpected export:", count, buf.String())
+	}
+	for i, text := range []string{"a", "b", "c"} {
+		var record SimpleStrict
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil || record.TextNotNull != text {
+			t.Fatal("unexpected line:", lines[i], err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := api.ExportJSONL(ctx, &buf, nil); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected cancellation, got:", err)
+	}
+}
+
+func TestRecordIdEscaping(t *testing.T) {
+	paths := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.EscapedPath())
+		if r.URL.RawQuery != "" {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple table")
+
+	id := StringRecordId("a/b?c#d e%")
+	if _, err := api.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Update(id, SimpleStrict{TextNotNull: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+
+	const path = "/api/records/v1/simple%20table/a%2Fb%3Fc%23d%20e%25"
+	if !testEq([]string{"GET " + path, "PATCH " + path, "DELETE " + path}, paths) {
+		t.Fatal("unexpected paths:", paths)
+	}
+
+	// Dot segments must not be resolved to the API's or its parent's path.
+	paths = paths[:0]
+	if _, err := api.Read(StringRecordId(".")); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Delete(StringRecordId("..")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRecordApi[SimpleStrict](client, "..").Read(StringRecordId("id")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"GET /api/records/v1/simple%20table/%2E",
+		"DELETE /api/records/v1/simple%20table/%2E%2E",
+		"GET /api/records/v1/%2E%2E/id",
+	}
+	if !testEq(expected, paths) {
+		t.Fatal("unexpected paths:", paths)
+	}
+}
+
+func TestReadInto(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/records/v1/simple_strict_table/full":
+			w.Write([]byte(`{"id": "full", "text_not_null": "test", "text_default": "default"}`))
+		case "/api/records/v1/simple_strict_table/partial":
+			w.Write([]byte(`{"id": "partial", "text_not_null": "other"}`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	var record SimpleStrict
+	if err := api.ReadInto(StringRecordId("full"), &record); err != nil || record.TextDefault == nil || *record.TextDefault != "default" {
+		t.Fatal("unexpected result:", record, err)
+	}
+	// Fields missing from the next record must not be carried over.
+	if err := api.ReadInto(StringRecordId("partial"), &record); err != nil || record.TextNotNull != "other" || record.TextDefault != nil {
+		t.Fatal("unexpected result:", record, err)
+	}
+	if err := api.ReadInto(StringRecordId("missing"), &record); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+type countingCodec struct {
+	marshaled   int
+	unmarshaled int
+}
+
+func (c *countingCodec) Marshal(v any) ([]byte, error) {
+	c.marshaled += 1
+	return json.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshaled += 1
+	return json.Unmarshal(data, v)
+}
+
+func TestWithCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Write([]byte(`{"ids": ["abc"]}`))
+		default:
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		}
+	}))
+	defer srv.Close()
+
+	codec := &countingCodec{}
+	client, err := NewClient(srv.URL, WithCodec(codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	id, err := api.Create(SimpleStrict{TextNotNull: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := api.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.TextNotNull != "test" {
+		t.Fatal("unexpected record:", record)
+	}
+
+	if codec.marshaled != 1 || codec.unmarshaled != 2 {
+		t.Fatalf("unexpected codec usage: %+v", codec)
+	}
+}
+
+func TestListMalformedResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"records": [{"text_not_null": "a"}, {"text_not_null": `))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	list, err := api.List(nil)
+	if err == nil {
+		t.Fatal("expected error, got:", list)
+	}
+	if list != nil {
+		t.Fatal("expected nil list, got:", list)
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	records := make([]SimpleStrict, 100)
+	for i := range records {
+		records[i] = SimpleStrict{TextNotNull: fmt.Sprint("benchmark record ", i)}
+	}
+	body, err := json.Marshal(ListResponse[SimpleStrict]{Records: records})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := api.List(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"ids": ["1"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithMaxRequestBodySize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	if _, err := api.Create(SimpleStrict{TextNotNull: "small"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.Create(SimpleStrict{TextNotNull: strings.Repeat("large", 20)})
+	if !errors.Is(err, ErrRequestBodyTooLarge) {
+		t.Fatal("expected ErrRequestBodyTooLarge, got:", err)
+	}
+	if requests != 1 {
+		t.Fatal("expected oversized request not to be sent, got requests:", requests)
+	}
+}
+
+// BenchmarkEncodeLargeRecord compares encoding a record with a large column
+// into a buffer against streaming it with json.Encoder. The encoder writes the
+// complete encoding from an internal, pooled buffer, i.e. streaming avoids
+// allocating the body but the full encoding is held in memory either way.
+func BenchmarkEncodeLargeRecord(b *testing.B) {
+	record := SimpleStrict{TextNotNull: strings.Repeat("x", 1<<20)}
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			body, err := json.Marshal(record)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(io.Discard, bytes.NewReader(body))
+		}
+	})
+
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			reader, writer := io.Pipe()
+			go func() {
+				writer.CloseWithError(json.NewEncoder(writer).Encode(record))
+			}()
+			if _, err := io.Copy(io.Discard, reader); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
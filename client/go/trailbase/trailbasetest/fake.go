@@ -0,0 +1,468 @@
+package trailbasetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/trailbaseio/trailbase/client/go/trailbase"
+)
+
+// FakeTransport is a trailbase.Transport emulating the record APIs of a
+// TrailBase server in memory. Unlike MockTransport, it holds state: created
+// records can be read, updated, deleted and listed again.
+//
+// Every record API name is accepted and backed by its own table, which is
+// created on first use. Records are identified by their "id" field, which is
+// assigned incrementally if absent on create. There is no schema, so records
+// are stored as given.
+//
+// List supports filters, ordering, limit, offset and count. Like the server's
+// defaults, the limit is 50 unless set and must not exceed 1024. Filter values are
+// compared numerically if both sides are numbers and as strings otherwise.
+// Cursors, expansion and geospatial filters are not supported. Requests to
+// other APIs fail with 404.
+type FakeTransport struct {
+	base *url.URL
+	// Base path of record APIs, see NewFakeClient.
+	recordApiPath string
+
+	mutex  sync.Mutex
+	tables map[string]*fakeTable
+}
+
+type fakeTable struct {
+	// Record ids in insertion order.
+	ids     []string
+	records map[string]map[string]any
+	nextId  int64
+}
+
+// NewFakeClient returns a client backed by a new, empty FakeTransport. Record
+// APIs are served below the client's record API path, see
+// trailbase.WithRecordApiPath.
+func NewFakeClient(opts ...trailbase.ClientOption) (*trailbase.Client, *FakeTransport) {
+	fake := NewFakeTransport()
+	client, err := trailbase.NewClient(fake.base.String(), append(opts, trailbase.WithTransport(fake))...)
+	if err != nil {
+		// Cannot happen with a well-formed base URL.
+		panic(err)
+	}
+	fake.recordApiPath = client.RecordApiPath()
+	return client, fake
+}
+
+func NewFakeTransport() *FakeTransport {
+	base, _ := url.Parse("http://trailbase.test")
+	return &FakeTransport{
+		base:          base,
+		recordApiPath: recordApi,
+		tables:        map[string]*fakeTable{},
+	}
+}
+
+func (f *FakeTransport) BaseUrl() *url.URL {
+	return f.base
+}
+
+func (f *FakeTransport) Get(u string) (*http.Response, error) {
+	return newResponse(http.StatusNotFound, "not supported by fake"), nil
+}
+
+func (f *FakeTransport) Do(ctx context.Context, method string, path string, headers []trailbase.Header, body []byte, queryParams []trailbase.QueryParam) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rest, ok := strings.CutPrefix(strings.Trim(path, "/"), f.recordApiPath+"/")
+	if !ok {
+		return newResponse(http.StatusNotFound, fmt.Sprintf("not supported by fake: %s %s", method, path)), nil
+	}
+	name, id, hasId := strings.Cut(rest, "/")
+	// The client escapes names and ids, which may contain e.g. "/".
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		return newResponse(http.StatusBadRequest, err.Error()), nil
+	}
+	if id, err = url.PathUnescape(id); err != nil {
+		return newResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	table, ok := f.tables[name]
+	if !ok {
+		table = &fakeTable{records: map[string]map[string]any{}}
+		f.tables[name] = table
+	}
+
+	switch {
+	case method == "POST" && !hasId:
+		return table.create(body), nil
+	case method == "GET" && !hasId:
+		return table.list(queryParams), nil
+	case method == "GET" && hasId:
+		return table.read(id), nil
+	case method == "PATCH" && hasId:
+		return table.update(id, body), nil
+	case method == "DELETE" && hasId:
+		return table.delete(id), nil
+	default:
+		return newResponse(http.StatusMethodNotAllowed, fmt.Sprintf("not supported by fake: %s %s", method, path)), nil
+	}
+}
+
+func (t *fakeTable) create(body []byte) *http.Response {
+	var records []map[string]any
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		if err := decodeJson(body, &records); err != nil {
+			return newResponse(http.StatusBadRequest, err.Error())
+		}
+	} else {
+		var record map[string]any
+		if err := decodeJson(body, &record); err != nil {
+			return newResponse(http.StatusBadRequest, err.Error())
+		}
+		records = append(records, record)
+	}
+
+	ids := []string{}
+	for _, record := range records {
+		if record == nil {
+			return newResponse(http.StatusBadRequest, "invalid record")
+		}
+		if _, ok := record["id"]; !ok {
+			t.nextId++
+			record["id"] = json.Number(strconv.FormatInt(t.nextId, 10))
+		}
+
+		id := fmt.Sprint(record["id"])
+		if _, exists := t.records[id]; exists || slices.Contains(ids, id) {
+			return newResponse(http.StatusConflict, fmt.Sprintf("record %s already exists", id))
+		}
+		ids = append(ids, id)
+	}
+
+	for i, record := range records {
+		t.ids = append(t.ids, ids[i])
+		t.records[ids[i]] = record
+	}
+	return newJsonResponse(map[string]any{"ids": ids})
+}
+
+func (t *fakeTable) read(id string) *http.Response {
+	record, ok := t.records[id]
+	if !ok {
+		return newResponse(http.StatusNotFound, "record not found")
+	}
+	return newJsonResponse(record)
+}
+
+func (t *fakeTable) update(id string, body []byte) *http.Response {
+	record, ok := t.records[id]
+	if !ok {
+		return newResponse(http.StatusNotFound, "record not found")
+	}
+
+	var patch map[string]any
+	if err := decodeJson(body, &patch); err != nil {
+		return newResponse(http.StatusBadRequest, err.Error())
+	}
+	if newId, ok := patch["id"]; ok && fmt.Sprint(newId) != id {
+		return newResponse(http.StatusBadRequest, "changing the record id is not supported by fake")
+	}
+
+	for key, value := range patch {
+		record[key] = value
+	}
+	return newResponse(http.StatusOK, "")
+}
+
+func (t *fakeTable) delete(id string) *http.Response {
+	if _, ok := t.records[id]; !ok {
+		return newResponse(http.StatusNotFound, "record not found")
+	}
+	delete(t.records, id)
+	t.ids = slices.DeleteFunc(t.ids, func(other string) bool { return other == id })
+	return newResponse(http.StatusOK, "")
+}
+
+func (t *fakeTable) list(queryParams []trailbase.QueryParam) *http.Response {
+	filter := filterNode{}
+	limit, offset := defaultLimit, int64(0)
+	var order []string
+	count := false
+
+	for _, param := range queryParams {
+		var err error
+		switch key := param.Key(); {
+		case key == "limit":
+			limit, err = strconv.ParseInt(param.Value(), 10, 64)
+		case key == "offset":
+			offset, err = strconv.ParseInt(param.Value(), 10, 64)
+		case key == "order":
+			order = strings.Split(param.Value(), ",")
+		case key == "count":
+			count = param.Value() == "true"
+		case strings.HasPrefix(key, "filter["):
+			err = filter.insert(key, param.Value())
+		default:
+			err = fmt.Errorf("query parameter %q not supported by fake", key)
+		}
+		if err != nil {
+			return newResponse(http.StatusBadRequest, err.Error())
+		}
+	}
+	if limit > hardLimit {
+		return newResponse(http.StatusBadRequest, "limit exceeds max limit of 1024")
+	}
+
+	records := []map[string]any{}
+	for _, id := range t.ids {
+		record := t.records[id]
+		matches, err := filter.matchesAll(record)
+		if err != nil {
+			return newResponse(http.StatusBadRequest, err.Error())
+		}
+		if matches {
+			records = append(records, record)
+		}
+	}
+
+	if len(order) > 0 {
+		sort.SliceStable(records, func(i, j int) bool {
+			for _, column := range order {
+				desc := strings.HasPrefix(column, "-")
+				column = strings.TrimLeft(column, "+-")
+
+				c := compareValues(records[i][column], records[j][column])
+				if c != 0 {
+					return (c < 0) != desc
+				}
+			}
+			return false
+		})
+	}
+
+	totalCount := int64(len(records))
+	records = records[min(offset, totalCount):]
+	records = records[:min(max(limit, 0), int64(len(records)))]
+
+	response := map[string]any{"records": records}
+	if count {
+		response["total_count"] = totalCount
+	}
+	return newJsonResponse(response)
+}
+
+// Default and maximum list limits of the server, see limit_or_default.
+const (
+	defaultLimit int64 = 50
+	hardLimit    int64 = 1024
+)
+
+// filterNode is a parsed "filter[...]" query parameter tree.
+type filterNode struct {
+	value    string
+	children map[string]*filterNode
+}
+
+// insert adds a parameter like "filter[$or][0][col][$gte]" to the tree.
+func (n *filterNode) insert(key string, value string) error {
+	if !strings.HasSuffix(key, "]") {
+		return fmt.Errorf("invalid filter parameter %q", key)
+	}
+	segments := strings.Split(strings.TrimSuffix(strings.TrimPrefix(key, "filter["), "]"), "][")
+	for _, segment := range segments {
+		if n.children == nil {
+			n.children = map[string]*filterNode{}
+		}
+		child, ok := n.children[segment]
+		if !ok {
+			child = &filterNode{}
+			n.children[segment] = child
+		}
+		n = child
+	}
+	n.value = value
+	return nil
+}
+
+// matchesAll reports whether record matches all of the node's children.
+func (n *filterNode) matchesAll(record map[string]any) (bool, error) {
+	for key, child := range n.children {
+		var matches bool
+		var err error
+		switch key {
+		case "$and":
+			matches, err = child.matchesAll(record)
+		case "$or":
+			matches, err = child.matchesAny(record)
+		default:
+			matches, err = child.matchesColumn(record[key])
+		}
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchesAny reports whether record matches any of the node's children.
+func (n *filterNode) matchesAny(record map[string]any) (bool, error) {
+	for _, child := range n.children {
+		matches, err := child.matchesAll(record)
+		if err != nil || matches {
+			return matches, err
+		}
+	}
+	return false, nil
+}
+
+// matchesColumn reports whether value satisfies all of the node's operators.
+func (n *filterNode) matchesColumn(value any) (bool, error) {
+	if n.children == nil {
+		return compareValues(value, n.value) == 0, nil
+	}
+
+	for op, child := range n.children {
+		if child.children != nil {
+			return false, fmt.Errorf("invalid filter for operator %q", op)
+		}
+
+		var matches bool
+		switch op {
+		case "$eq":
+			matches = value != nil && compareValues(value, child.value) == 0
+		case "$ne":
+			matches = value != nil && compareValues(value, child.value) != 0
+		case "$lt":
+			matches = value != nil && compareValues(value, child.value) < 0
+		case "$lte":
+			matches = value != nil && compareValues(value, child.value) <= 0
+		case "$gt":
+			matches = value != nil && compareValues(value, child.value) > 0
+		case "$gte":
+			matches = value != nil && compareValues(value, child.value) >= 0
+		case "$is":
+			switch child.value {
+			case "NULL":
+				matches = value == nil
+			case "!NULL":
+				matches = value != nil
+			default:
+				return false, fmt.Errorf("invalid $is value %q", child.value)
+			}
+		case "$like":
+			re, err := likeToRegexp(child.value)
+			if err != nil {
+				return false, err
+			}
+			matches = value != nil && re.MatchString(fmt.Sprint(value))
+		case "$re":
+			re, err := regexp.Compile(child.value)
+			if err != nil {
+				return false, err
+			}
+			matches = value != nil && re.MatchString(fmt.Sprint(value))
+		default:
+			return false, fmt.Errorf("operator %q not supported by fake", op)
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareValues compares numerically if both a and b are numbers and as
+// strings otherwise. NULLs sort first.
+func compareValues(a any, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+	af, aErr := strconv.ParseFloat(as, 64)
+	bf, bErr := strconv.ParseFloat(bs, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(as, bs)
+}
+
+// likeToRegexp translates a LIKE pattern with '\' as escape character into an
+// equivalent regular expression. Like SQLite, matching is case-insensitive.
+func likeToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func decodeJson(body []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func newJsonResponse(v any) *http.Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return newResponse(http.StatusInternalServerError, err.Error())
+	}
+	response := newResponse(http.StatusOK, string(body))
+	response.Header.Set("Content-Type", "application/json")
+	return response
+}
+
+func newResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
@@ -0,0 +1,211 @@
+package trailbasetest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/trailbaseio/trailbase/client/go/trailbase"
+)
+
+type Product struct {
+	Id    *int64 `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+func TestFakeClient(t *testing.T) {
+	client, _ := NewFakeClient()
+	api := trailbase.NewRecordApi[Product](client, "products")
+
+	ids := []trailbase.RecordId{}
+	for _, p := range []Product{{Name: "apple", Price: 3}, {Name: "Banana", Price: 1}, {Name: "cherry", Price: 10}} {
+		id, err := api.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	product, err := api.Read(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "Banana" || product.Id == nil || *product.Id != 2 {
+		t.Fatal("unexpected product:", product)
+	}
+
+	if err := api.Update(ids[1], Product{Name: "banana", Price: 2}); err != nil {
+		t.Fatal(err)
+	}
+	product, err = api.Read(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "banana" || product.Price != 2 {
+		t.Fatal("unexpected product:", product)
+	}
+
+	if err := api.Delete(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	_, found, err := api.ReadOptional(ids[0])
+	if err != nil || found {
+		t.Fatal("expected deleted product to be gone:", found, err)
+	}
+
+	var ferr *trailbase.FetchError
+	if err := api.Delete(ids[0]); !errors.As(err, &ferr) || ferr.StatusCode != 404 {
+		t.Fatal("expected 404, got:", err)
+	}
+}
+
+func TestFakeClientList(t *testing.T) {
+	client, _ := NewFakeClient()
+	api := trailbase.NewRecordApi[Product](client, "products")
+
+	for i, name := range []string{"apple", "banana", "cherry", "date", "elderberry"} {
+		if _, err := api.Create(Product{Name: name, Price: int64(10 - 2*i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(args *trailbase.ListArguments) []string {
+		t.Helper()
+		list, err := api.List(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, p := range list.Records {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	expect := func(got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	}
+
+	expect(names(nil), "apple", "banana", "cherry", "date", "elderberry")
+	expect(names(&trailbase.ListArguments{
+		Filters: []trailbase.Filter{trailbase.FilterBetween{Column: "price", Low: "4", High: "8"}},
+	}), "banana", "cherry", "date")
+	expect(names(&trailbase.ListArguments{
+		Filters: []trailbase.Filter{trailbase.Or(
+			trailbase.StartsWith("name", "A"),
+			trailbase.FilterColumn{Column: "price", Op: trailbase.LessThan, Value: "3"},
+		)},
+	}), "apple", "elderberry")
+	expect(names(&trailbase.ListArguments{
+		Filters: []trailbase.Filter{trailbase.FilterColumn{Column: "name", Value: "date"}},
+	}), "date")
+
+	limit := uint64(2)
+	offset := uint64(1)
+	expect(names(&trailbase.ListArguments{
+		Order:      []string{"price"},
+		Pagination: trailbase.Pagination{Limit: &limit, Offset: &offset},
+	}), "date", "cherry")
+
+	list, err := api.List(&trailbase.ListArguments{
+		Filters: []trailbase.Filter{trailbase.Contains("name", "rr")},
+		Count:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.TotalCount == nil || *list.TotalCount != 2 {
+		t.Fatal("unexpected count:", list.TotalCount)
+	}
+}
+
+func TestFakeClientListLimits(t *testing.T) {
+	client, _ := NewFakeClient()
+	api := trailbase.NewRecordApi[Product](client, "products")
+
+	products := make([]Product, 60)
+	for i := range products {
+		products[i] = Product{Name: fmt.Sprint("product ", i)}
+	}
+	if _, _, err := api.CreateMany(products, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(limit *uint64) (*trailbase.ListResponse[Product], error) {
+		return api.List(&trailbase.ListArguments{Count: true, Pagination: trailbase.Pagination{Limit: limit}})
+	}
+
+	page, err := list(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 50 {
+		t.Fatal("expected default limit of 50, got:", len(page.Records))
+	}
+
+	zero := uint64(0)
+	page, err = list(&zero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 0 || page.TotalCount == nil || *page.TotalCount != 60 {
+		t.Fatal("expected only a count for limit 0, got:", page)
+	}
+
+	tooLarge := uint64(1025)
+	var ferr *trailbase.FetchError
+	if _, err := list(&tooLarge); !errors.As(err, &ferr) || ferr.StatusCode != 400 {
+		t.Fatal("expected 400, got:", err)
+	}
+}
+
+func TestFakeClientRecordApiPath(t *testing.T) {
+	client, _ := NewFakeClient(trailbase.WithRecordApiPath("custom/records"))
+	api := trailbase.NewRecordApi[Product](client, "products")
+
+	id, err := api.Create(Product{Name: "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	product, err := api.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "apple" {
+		t.Fatal("unexpected product:", product)
+	}
+}
+
+func TestFakeClientEscapedIds(t *testing.T) {
+	type Tag struct {
+		Id    string `json:"id"`
+		Label string `json:"label"`
+	}
+
+	client, _ := NewFakeClient()
+	api := trailbase.NewRecordApi[Tag](client, "tag list")
+
+	for _, id := range []string{"a/b c", "50%", ".", ".."} {
+		if _, err := api.Create(Tag{Id: id, Label: "label " + id}); err != nil {
+			t.Fatal(err)
+		}
+		tag, err := api.Read(trailbase.StringRecordId(id))
+		if err != nil {
+			t.Fatal(id, err)
+		}
+		if tag.Id != id {
+			t.Fatal("unexpected tag:", tag)
+		}
+		if err := api.Delete(trailbase.StringRecordId(id)); err != nil {
+			t.Fatal(id, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package trailbasetest provides a fake TrailBase server transport, which
+// lets users unit test code built on the client without a running server.
+package trailbasetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"net/http"
+	"net/url"
+
+	"github.com/trailbaseio/trailbase/client/go/trailbase"
+)
+
+// Call records a single request received by the MockTransport.
+type Call struct {
+	Method string
+	// Path relative to the base URL, e.g. "api/records/v1/movies/1".
+	Path  string
+	Query url.Values
+	Body  []byte
+}
+
+// Response is a canned response returned by the MockTransport.
+type Response struct {
+	StatusCode int
+	Body       string
+}
+
+// MockTransport is a trailbase.Transport returning canned responses and
+// recording all requests.
+type MockTransport struct {
+	base *url.URL
+	// Base path of record APIs, see RespondRecordApi.
+	recordApiPath string
+
+	mutex     sync.Mutex
+	responses map[string]Response
+	calls     []Call
+}
+
+// NewMockClient returns a client backed by a new MockTransport. Record API
+// responses follow the client's record API path, see
+// trailbase.WithRecordApiPath.
+func NewMockClient(opts ...trailbase.ClientOption) (*trailbase.Client, *MockTransport) {
+	mock := NewMockTransport()
+	client, err := trailbase.NewClient(mock.base.String(), append(opts, trailbase.WithTransport(mock))...)
+	if err != nil {
+		// Cannot happen with a well-formed base URL.
+		panic(err)
+	}
+	mock.recordApiPath = client.RecordApiPath()
+	return client, mock
+}
+
+func NewMockTransport() *MockTransport {
+	base, _ := url.Parse("http://trailbase.test")
+	return &MockTransport{
+		base:          base,
+		recordApiPath: recordApi,
+		responses:     map[string]Response{},
+	}
+}
+
+// Respond registers a canned response for requests with the given method and
+// path, e.g. ("GET", "api/records/v1/movies/1").
+func (m *MockTransport) Respond(method string, path string, response Response) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.responses[responseKey(method, strings.Trim(path, "/"))] = response
+}
+
+// RespondRecordApi registers a canned response for all requests with the given
+// method to the named record API. Responses registered for an exact path via
+// Respond take precedence. Record APIs are expected below "api/records/v1",
+// unless the transport was created by NewMockClient with a different
+// trailbase.WithRecordApiPath.
+func (m *MockTransport) RespondRecordApi(name string, method string, response Response) {
+	m.Respond(method, m.recordApiPath+"/"+name+"/*", response)
+}
+
+// Calls returns all requests received so far.
+func (m *MockTransport) Calls() []Call {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Call{}, m.calls...)
+}
+
+// Called reports whether a request with the given method and path was
+// received.
+func (m *MockTransport) Called(method string, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, call := range m.Calls() {
+		if call.Method == method && call.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertCalled fails the test unless a request with the given method and path
+// was received.
+func (m *MockTransport) AssertCalled(t testing.TB, method string, path string) {
+	t.Helper()
+	if !m.Called(method, path) {
+		t.Fatalf("expected call %s %s, got: %v", method, path, m.Calls())
+	}
+}
+
+// AssertNotCalled fails the test if a request with the given method and path
+// was received.
+func (m *MockTransport) AssertNotCalled(t testing.TB, method string, path string) {
+	t.Helper()
+	if m.Called(method, path) {
+		t.Fatalf("unexpected call %s %s", method, path)
+	}
+}
+
+func (m *MockTransport) BaseUrl() *url.URL {
+	return m.base
+}
+
+func (m *MockTransport) Do(ctx context.Context, method string, path string, headers []trailbase.Header, body []byte, queryParams []trailbase.QueryParam) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	for _, param := range queryParams {
+		query.Add(param.Key(), param.Value())
+	}
+
+	path = strings.Trim(path, "/")
+	return m.record(Call{
+		Method: method,
+		Path:   path,
+		Query:  query,
+		Body:   body,
+	}), nil
+}
+
+func (m *MockTransport) Get(u string) (*http.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimPrefix(parsed.Path, m.base.Path)
+	return m.record(Call{
+		Method: "GET",
+		Path:   strings.Trim(path, "/"),
+		Query:  parsed.Query(),
+	}), nil
+}
+
+func (m *MockTransport) record(call Call) *http.Response {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.calls = append(m.calls, call)
+
+	response, ok := m.responses[responseKey(call.Method, call.Path)]
+	if !ok {
+		response, ok = m.responses[responseKey(call.Method, recordApiWildcard(m.recordApiPath, call.Path))]
+	}
+	if !ok {
+		response = Response{
+			StatusCode: http.StatusNotFound,
+			Body:       fmt.Sprintf("no mock response for %s %s", call.Method, call.Path),
+		}
+	}
+
+	return &http.Response{
+		StatusCode: response.StatusCode,
+		Status:     http.StatusText(response.StatusCode),
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(response.Body)),
+	}
+}
+
+func responseKey(method string, path string) string {
+	return method + " " + path
+}
+
+// recordApiWildcard maps "<prefix>/<name>/..." to "<prefix>/<name>/*" with
+// name unescaped, as registered by RespondRecordApi.
+func recordApiWildcard(prefix string, path string) string {
+	rest, ok := strings.CutPrefix(path, prefix+"/")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		return ""
+	}
+	return prefix + "/" + name + "/*"
+}
+
+const recordApi string = "api/records/v1"
@@ -0,0 +1,105 @@
+package trailbasetest
+
+import (
+	"testing"
+
+	"github.com/trailbaseio/trailbase/client/go/trailbase"
+)
+
+type Movie struct {
+	Name string `json:"name"`
+}
+
+func TestMockClient(t *testing.T) {
+	client, mock := NewMockClient()
+	mock.RespondRecordApi("movies", "GET", Response{StatusCode: 200, Body: `{"name": "any"}`})
+	mock.Respond("GET", "api/records/v1/movies/2", Response{StatusCode: 200, Body: `{"name": "second"}`})
+	mock.RespondRecordApi("movies", "DELETE", Response{StatusCode: 200})
+
+	api := trailbase.NewRecordApi[Movie](client, "movies")
+
+	movie, err := api.Read(trailbase.IntRecordId(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Name != "any" {
+		t.Fatal("unexpected movie:", movie)
+	}
+
+	movie, err = api.Read(trailbase.IntRecordId(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Name != "second" {
+		t.Fatal("unexpected movie:", movie)
+	}
+
+	if err := api.Delete(trailbase.IntRecordId(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unregistered routes fail.
+	if _, err := api.Create(Movie{Name: "new"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	mock.AssertCalled(t, "GET", "api/records/v1/movies/1")
+	mock.AssertCalled(t, "DELETE", "api/records/v1/movies/1")
+	mock.AssertCalled(t, "POST", "api/records/v1/movies")
+	mock.AssertNotCalled(t, "DELETE", "api/records/v1/movies/2")
+
+	calls := mock.Calls()
+	if len(calls) != 4 {
+		t.Fatal("expected 4 calls, got:", calls)
+	}
+	if string(calls[3].Body) != `{"name":"new"}` {
+		t.Fatal("unexpected body:", string(calls[3].Body))
+	}
+}
+
+func TestMockClientRecordApiPath(t *testing.T) {
+	client, mock := NewMockClient(trailbase.WithRecordApiPath("/custom/records/"))
+	mock.RespondRecordApi("movies", "GET", Response{StatusCode: 200, Body: `{"name": "any"}`})
+
+	api := trailbase.NewRecordApi[Movie](client, "movies")
+	movie, err := api.Read(trailbase.IntRecordId(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Name != "any" {
+		t.Fatal("unexpected movie:", movie)
+	}
+	mock.AssertCalled(t, "GET", "custom/records/movies/1")
+}
+
+func TestMockClientEscapedName(t *testing.T) {
+	client, mock := NewMockClient()
+	mock.RespondRecordApi("my movies", "GET", Response{StatusCode: 200, Body: `{"name": "any"}`})
+
+	api := trailbase.NewRecordApi[Movie](client, "my movies")
+	if _, err := api.Read(trailbase.StringRecordId("a/b")); err != nil {
+		t.Fatal(err)
+	}
+	mock.AssertCalled(t, "GET", "api/records/v1/my%20movies/a%2Fb")
+}
+
+func TestMockClientListQuery(t *testing.T) {
+	client, mock := NewMockClient()
+	mock.RespondRecordApi("movies", "GET", Response{StatusCode: 200, Body: `{"records": [{"name": "a"}]}`})
+
+	api := trailbase.NewRecordApi[Movie](client, "movies")
+	list, err := api.List(&trailbase.ListArguments{
+		Filters: []trailbase.Filter{trailbase.Contains("name", "a")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Records) != 1 {
+		t.Fatal("unexpected records:", list.Records)
+	}
+
+	calls := mock.Calls()
+	if got := calls[0].Query.Get("filter[name][$like]"); got != "%a%" {
+		t.Fatal("unexpected filter:", got)
+	}
+}
@@ -0,0 +1,326 @@
+package trailbase
+
+import (
+	"errors"
+	"fmt"
+
+	"encoding/json"
+)
+
+type OperationKind int
+
+const (
+	CreateOperation OperationKind = iota
+	UpdateOperation
+	DeleteOperation
+)
+
+func (k OperationKind) String() string {
+	switch k {
+	case CreateOperation:
+		return "Create"
+	case UpdateOperation:
+		return "Update"
+	case DeleteOperation:
+		return "Delete"
+	default:
+		return fmt.Sprintf("OperationKind(%d)", int(k))
+	}
+}
+
+// Operation is a single record mutation executed as part of a
+// TransactionBatch.
+type Operation struct {
+	Kind     OperationKind
+	ApiName  string
+	RecordId RecordId
+	Value    any
+}
+
+// InvalidOperationError is returned by TransactionBatch.Send for operations
+// that fail local validation, before any request is sent.
+type InvalidOperationError struct {
+	Index   int
+	Kind    OperationKind
+	ApiName string
+	Reason  string
+	// Err is the underlying error, if any, e.g. when Value cannot be marshaled.
+	Err error
+}
+
+func (e *InvalidOperationError) Error() string {
+	return fmt.Sprintf("InvalidOperationError(operation %d: %s on %q: %s)", e.Index, e.Kind, e.ApiName, e.Reason)
+}
+
+func (e *InvalidOperationError) Unwrap() error {
+	return e.Err
+}
+
+// validate checks that op has all the fields required by its kind.
+func (op Operation) validate(index int) error {
+	invalid := func(reason string, err error) error {
+		return &InvalidOperationError{Index: index, Kind: op.Kind, ApiName: op.ApiName, Reason: reason, Err: err}
+	}
+
+	if op.ApiName == "" {
+		return invalid("missing api name", nil)
+	}
+
+	switch op.Kind {
+	case CreateOperation:
+		if op.Value == nil {
+			return invalid("missing value", nil)
+		}
+	case UpdateOperation:
+		if op.RecordId == nil || op.RecordId.ToString() == "" {
+			return invalid("missing record id", nil)
+		}
+		if op.Value == nil {
+			return invalid("missing value", nil)
+		}
+	case DeleteOperation:
+		if op.RecordId == nil || op.RecordId.ToString() == "" {
+			return invalid("missing record id", nil)
+		}
+	default:
+		return invalid("unknown operation kind", nil)
+	}
+	return nil
+}
+
+func (op Operation) MarshalJSON() ([]byte, error) {
+	return op.marshal(jsonCodec{})
+}
+
+// marshal encodes op in the server's externally tagged format, encoding the
+// value with codec.
+func (op Operation) marshal(codec Codec) ([]byte, error) {
+	type createOperation struct {
+		ApiName string          `json:"api_name"`
+		Value   json.RawMessage `json:"value"`
+	}
+	type updateOperation struct {
+		ApiName  string          `json:"api_name"`
+		RecordId string          `json:"record_id"`
+		Value    json.RawMessage `json:"value"`
+	}
+	type deleteOperation struct {
+		ApiName  string `json:"api_name"`
+		RecordId string `json:"record_id"`
+	}
+
+	var value json.RawMessage
+	if op.Kind == CreateOperation || op.Kind == UpdateOperation {
+		var err error
+		if value, err = codec.Marshal(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	// The envelope only holds strings and the already encoded value.
+	var wrapper map[string]any
+	switch op.Kind {
+	case CreateOperation:
+		wrapper = map[string]any{
+			"Create": createOperation{ApiName: op.ApiName, Value: value},
+		}
+	case UpdateOperation:
+		wrapper = map[string]any{
+			"Update": updateOperation{ApiName: op.ApiName, RecordId: op.RecordId.ToString(), Value: value},
+		}
+	case DeleteOperation:
+		wrapper = map[string]any{
+			"Delete": deleteOperation{ApiName: op.ApiName, RecordId: op.RecordId.ToString()},
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation kind: %s", op.Kind)
+	}
+	return json.Marshal(wrapper)
+}
+
+// TransactionBatch collects record mutations, possibly across multiple record
+// APIs, to be executed in a single request, see Client.Transaction.
+type TransactionBatch struct {
+	client     *Client
+	operations []Operation
+}
+
+// Transaction starts a new, empty batch of operations.
+func (c *Client) Transaction() *TransactionBatch {
+	return &TransactionBatch{
+		client: c,
+	}
+}
+
+// Api returns a builder for adding operations against the named record API.
+func (b *TransactionBatch) Api(name string) *ApiBatch {
+	return &ApiBatch{
+		batch: b,
+		name:  name,
+	}
+}
+
+// Operations returns the operations added so far.
+func (b *TransactionBatch) Operations() []Operation {
+	return b.operations
+}
+
+func (b *TransactionBatch) addOperation(op Operation) {
+	b.operations = append(b.operations, op)
+}
+
+// MaxTransactionOperations is the server's limit on the number of operations
+// in a single batch.
+const MaxTransactionOperations = 128
+
+// ErrTransactionTooLarge is returned for batches with more than
+// MaxTransactionOperations operations, before any request is sent.
+var ErrTransactionTooLarge = fmt.Errorf("batch exceeds %d operations", MaxTransactionOperations)
+
+// Send executes all operations in a single transaction, i.e. either all or none
+// are applied. It returns the ids of the affected records in operation order.
+func (b *TransactionBatch) Send() ([]RecordId, error) {
+	return b.send(true)
+}
+
+// SendWithoutTransaction executes the operations one after another without
+// wrapping them in a transaction. If an operation fails, the remaining ones are
+// skipped, however the ones before it stay applied.
+func (b *TransactionBatch) SendWithoutTransaction() ([]RecordId, error) {
+	return b.send(false)
+}
+
+func (b *TransactionBatch) send(transaction bool) ([]RecordId, error) {
+	if len(b.operations) > MaxTransactionOperations {
+		return nil, ErrTransactionTooLarge
+	}
+
+	// Validate and encode up front to attribute errors to the offending
+	// operation rather than the batch as a whole. Values are encoded by the
+	// client's codec, i.e. exactly as they are sent.
+	operations := make([]json.RawMessage, len(b.operations))
+	for i, op := range b.operations {
+		if err := op.validate(i); err != nil {
+			return nil, err
+		}
+		encoded, err := op.marshal(b.client.codec)
+		if err != nil {
+			return nil, &InvalidOperationError{Index: i, Kind: op.Kind, ApiName: op.ApiName, Reason: fmt.Sprint("invalid value: ", err), Err: err}
+		}
+		operations[i] = encoded
+	}
+
+	type TransactionRequest struct {
+		Operations  []json.RawMessage `json:"operations"`
+		Transaction bool              `json:"transaction"`
+	}
+
+	reqBody, err := b.client.codec.Marshal(TransactionRequest{
+		Operations:  operations,
+		Transaction: transaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.do("POST", b.client.transactionApiPath+"/execute", reqBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	type TransactionResult struct {
+		Id    *string `json:"Id,omitempty"`
+		Error *string `json:"Error,omitempty"`
+	}
+	type TransactionResponse struct {
+		Results []TransactionResult `json:"results"`
+	}
+
+	var transactionResponse TransactionResponse
+	err = decodeBody(b.client.codec, resp.Body, &transactionResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactionResponse.Results) != len(b.operations) {
+		return nil, errors.New("mismatching number of results")
+	}
+
+	ids := make([]RecordId, len(transactionResponse.Results))
+	for i, result := range transactionResponse.Results {
+		if result.Error != nil {
+			return nil, fmt.Errorf("operation %d (%s on %q) failed: %s", i, b.operations[i].Kind, b.operations[i].ApiName, *result.Error)
+		}
+		if result.Id != nil {
+			ids[i] = StringRecordId(*result.Id)
+		}
+	}
+	return ids, nil
+}
+
+// ApiBatch adds operations against a single record API to a TransactionBatch.
+type ApiBatch struct {
+	batch *TransactionBatch
+	name  string
+}
+
+func (a *ApiBatch) Create(value any) *ApiBatch {
+	a.batch.addOperation(Operation{
+		Kind:    CreateOperation,
+		ApiName: a.name,
+		Value:   value,
+	})
+	return a
+}
+
+func (a *ApiBatch) Update(id RecordId, value any) *ApiBatch {
+	a.batch.addOperation(Operation{
+		Kind:     UpdateOperation,
+		ApiName:  a.name,
+		RecordId: id,
+		Value:    value,
+	})
+	return a
+}
+
+func (a *ApiBatch) Delete(id RecordId) *ApiBatch {
+	a.batch.addOperation(Operation{
+		Kind:     DeleteOperation,
+		ApiName:  a.name,
+		RecordId: id,
+	})
+	return a
+}
+
+// TxCreate adds a typed create operation for the given record API to batch.
+// Unlike ApiBatch.Create, the record's type is checked against the API's at
+// compile time.
+func TxCreate[T any](batch *TransactionBatch, api *RecordApi[T], record T) {
+	batch.addOperation(Operation{
+		Kind:    CreateOperation,
+		ApiName: api.name,
+		Value:   record,
+	})
+}
+
+// TxUpdate adds a typed update operation for the given record API to batch.
+func TxUpdate[T any](batch *TransactionBatch, api *RecordApi[T], id RecordId, record T) {
+	batch.addOperation(Operation{
+		Kind:     UpdateOperation,
+		ApiName:  api.name,
+		RecordId: id,
+		Value:    record,
+	})
+}
+
+// TxDelete adds a delete operation for the given record API to batch.
+func TxDelete[T any](batch *TransactionBatch, api *RecordApi[T], id RecordId) {
+	batch.addOperation(Operation{
+		Kind:     DeleteOperation,
+		ApiName:  api.name,
+		RecordId: id,
+	})
+}
+
+const transactionApi string = "api/transaction/v1"
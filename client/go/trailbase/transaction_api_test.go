@@ -0,0 +1,264 @@
+package trailbase
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOperationMarshalJSON(t *testing.T) {
+	ops := []Operation{
+		{Kind: CreateOperation, ApiName: "api", Value: map[string]any{"col": 1}},
+		{Kind: UpdateOperation, ApiName: "api", RecordId: IntRecordId(5), Value: map[string]any{"col": 2}},
+		{Kind: DeleteOperation, ApiName: "api", RecordId: StringRecordId("abc")},
+	}
+	expected := []string{
+		`{"Create":{"api_name":"api","value":{"col":1}}}`,
+		`{"Update":{"api_name":"api","record_id":"5","value":{"col":2}}}`,
+		`{"Delete":{"api_name":"api","record_id":"abc"}}`,
+	}
+
+	for i, op := range ops {
+		got, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected[i] {
+			t.Fatalf("got %s, want %s", got, expected[i])
+		}
+	}
+}
+
+func TestTransactionInvalidValue(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := client.Transaction()
+	batch.Api("first").Create(map[string]any{"col": 1})
+	batch.Api("second").Create(map[string]any{"col": make(chan int)})
+
+	_, err = batch.Send()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "operation 1") || !strings.Contains(err.Error(), `"second"`) {
+		t.Fatal("expected error to name operation and api, got:", err)
+	}
+	var jsonErr *json.UnsupportedTypeError
+	if !errors.As(err, &jsonErr) {
+		t.Fatal("expected wrapped json error, got:", err)
+	}
+	if called {
+		t.Fatal("expected no request to be sent")
+	}
+}
+
+// valueCodec encodes strings as "codec:<value>" and rejects bools, which
+// encoding/json would both accept as is.
+type valueCodec struct{}
+
+func (valueCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return json.Marshal("codec:" + v)
+	case bool:
+		return nil, errors.New("bools not supported")
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func (valueCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func TestTransactionCodec(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"results": [{"Id": "1"}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithCodec(valueCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := client.Transaction()
+	batch.Api("api").Create("value")
+	if _, err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"operations":[{"Create":{"api_name":"api","value":"codec:value"}}],"transaction":true}`
+	if body != expected {
+		t.Fatalf("got %s, want %s", body, expected)
+	}
+
+	// Values are rejected by the codec that would encode them.
+	body = ""
+	batch = client.Transaction()
+	batch.Api("api").Create("value")
+	batch.Api("other").Create(true)
+	_, err = batch.Send()
+	var opErr *InvalidOperationError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || opErr.ApiName != "other" {
+		t.Fatal("expected InvalidOperationError for operation 1, got:", err)
+	}
+	if body != "" {
+		t.Fatal("expected no request to be sent")
+	}
+}
+
+func TestTransactionValidation(t *testing.T) {
+	tests := []struct {
+		op     Operation
+		reason string
+	}{
+		{Operation{Kind: CreateOperation, Value: 1}, "missing api name"},
+		{Operation{Kind: CreateOperation, ApiName: "api"}, "missing value"},
+		{Operation{Kind: UpdateOperation, ApiName: "api", Value: 1}, "missing record id"},
+		{Operation{Kind: UpdateOperation, ApiName: "api", RecordId: StringRecordId(""), Value: 1}, "missing record id"},
+		{Operation{Kind: UpdateOperation, ApiName: "api", RecordId: IntRecordId(1)}, "missing value"},
+		{Operation{Kind: DeleteOperation, ApiName: "api"}, "missing record id"},
+		{Operation{Kind: DeleteOperation, RecordId: IntRecordId(1)}, "missing api name"},
+		{Operation{Kind: OperationKind(42), ApiName: "api"}, "unknown operation kind"},
+	}
+
+	client, err := NewClient("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		batch := client.Transaction()
+		batch.Api("api").Create(1)
+		batch.addOperation(test.op)
+
+		_, err := batch.Send()
+		var opErr *InvalidOperationError
+		if !errors.As(err, &opErr) {
+			t.Fatalf("%+v: expected InvalidOperationError, got: %v", test.op, err)
+		}
+		if opErr.Index != 1 || opErr.Reason != test.reason {
+			t.Fatalf("%+v: unexpected error: %v", test.op, opErr)
+		}
+	}
+}
+
+func TestTypedTransactionHelpers(t *testing.T) {
+	type Other struct {
+		Name string `json:"name"`
+	}
+
+	client, err := NewClient("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := NewRecordApi[SimpleStrict](client, "simple")
+	other := NewRecordApi[Other](client, "other")
+
+	batch := client.Transaction()
+	TxCreate(batch, simple, SimpleStrict{TextNotNull: "a"})
+	TxUpdate(batch, other, IntRecordId(1), Other{Name: "b"})
+	batch.Api("other").Delete(IntRecordId(2))
+	TxDelete(batch, simple, StringRecordId("c"))
+
+	expected := []string{
+		`{"Create":{"api_name":"simple","value":{"text_not_null":"a"}}}`,
+		`{"Update":{"api_name":"other","record_id":"1","value":{"name":"b"}}}`,
+		`{"Delete":{"api_name":"other","record_id":"2"}}`,
+		`{"Delete":{"api_name":"simple","record_id":"c"}}`,
+	}
+	ops := batch.Operations()
+	if len(ops) != len(expected) {
+		t.Fatal("unexpected operations:", ops)
+	}
+	for i, op := range ops {
+		got, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected[i] {
+			t.Fatalf("got %s, want %s", got, expected[i])
+		}
+	}
+}
+
+func TestTransactionMode(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Write([]byte(`{"results": [{"Id": "1"}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := client.Transaction()
+	batch.Api("api").Delete(IntRecordId(1))
+	if _, err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := batch.SendWithoutTransaction(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`{"operations":[{"Delete":{"api_name":"api","record_id":"1"}}],"transaction":true}`,
+		`{"operations":[{"Delete":{"api_name":"api","record_id":"1"}}],"transaction":false}`,
+	}
+	if len(bodies) != len(expected) {
+		t.Fatal("unexpected requests:", bodies)
+	}
+	for i, body := range bodies {
+		if body != expected[i] {
+			t.Fatalf("got %s, want %s", body, expected[i])
+		}
+	}
+}
+
+func TestTransactionTooLarge(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := client.Transaction()
+	for i := range MaxTransactionOperations + 1 {
+		batch.Api("api").Delete(IntRecordId(int64(i + 1)))
+	}
+
+	if _, err := batch.Send(); !errors.Is(err, ErrTransactionTooLarge) {
+		t.Fatal("expected ErrTransactionTooLarge, got:", err)
+	}
+	if _, err := batch.SendWithoutTransaction(); !errors.Is(err, ErrTransactionTooLarge) {
+		t.Fatal("expected ErrTransactionTooLarge, got:", err)
+	}
+	if called {
+		t.Fatal("expected no request to be sent")
+	}
+}
@@ -2,22 +2,48 @@ package trailbase
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"encoding/json"
 
 	"net/http"
+	"net/http/httputil"
 	"net/url"
 )
 
+// Transport performs the client's HTTP requests. Implementations must be safe
+// for concurrent use, since a transport is shared by all clones of a Client,
+// see Client.Clone.
 type Transport interface {
 	BaseUrl() *url.URL
 	// Similar to `http.Client.Do`.
-	Do(method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error)
+	Do(ctx context.Context, method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error)
 	// Convenience short-cut.
 	Get(url string) (*http.Response, error)
 }
 
+// StreamingTransport is optionally implemented by Transports able to send
+// request bodies without buffering them in memory, e.g. for file uploads, see
+// RecordApi.CreateMultipart. Otherwise, such bodies are read into memory and
+// passed to Do.
+type StreamingTransport interface {
+	Transport
+	// Like Do but reads the request's body from body.
+	DoStream(ctx context.Context, method string, path string, headers []Header, body io.Reader, queryParams []QueryParam) (*http.Response, error)
+}
+
 type defaultTransport struct {
 	base   *url.URL
 	client *http.Client
+
+	// Optional sink for dumping requests and responses, see WithRequestDump.
+	dump      io.Writer
+	dumpMutex sync.Mutex
 }
 
 func (c *defaultTransport) BaseUrl() *url.URL {
@@ -28,13 +54,29 @@ func (c *defaultTransport) Get(url string) (*http.Response, error) {
 	return c.client.Get(url)
 }
 
-func (c *defaultTransport) Do(method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
-	req, err := http.NewRequest(method, c.base.JoinPath(path).String(), bytes.NewBuffer(body))
+func (c *defaultTransport) Do(ctx context.Context, method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, headers, bytes.NewReader(body), queryParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req, body, false)
+}
+
+func (c *defaultTransport) DoStream(ctx context.Context, method string, path string, headers []Header, body io.Reader, queryParams []QueryParam) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, headers, body, queryParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req, nil, true)
+}
+
+func (c *defaultTransport) newRequest(ctx context.Context, method string, path string, headers []Header, body io.Reader, queryParams []QueryParam) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base.JoinPath(path).String(), body)
 	if err != nil {
 		return nil, err
 	}
 	for _, header := range headers {
-		req.Header.Add(header.key, header.value)
+		req.Header.Set(header.key, header.value)
 	}
 	if len(queryParams) > 0 {
 		query := req.URL.Query()
@@ -43,5 +85,171 @@ func (c *defaultTransport) Do(method string, path string, headers []Header, body
 		}
 		req.URL.RawQuery = query.Encode()
 	}
-	return c.client.Do(req)
+	return req, nil
+}
+
+// send sends req, dumping it if enabled. Streamed bodies are not dumped since
+// they can only be read once.
+func (c *defaultTransport) send(req *http.Request, body []byte, streamed bool) (*http.Response, error) {
+	if c.dump == nil {
+		return c.client.Do(req)
+	}
+
+	c.dumpRequest(req, body, streamed)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.dumpResponse(resp)
+	return resp, nil
+}
+
+func (c *defaultTransport) dumpRequest(req *http.Request, body []byte, streamed bool) {
+	redacted := req.Clone(req.Context())
+	redacted.Header = redactHeaders(req.Header)
+	if streamed {
+		dump, err := httputil.DumpRequestOut(redacted, false)
+		c.writeDump(dump, err)
+		return
+	}
+
+	masked := maskSecretFields(body)
+	redacted.Body = io.NopCloser(bytes.NewReader(masked))
+	redacted.ContentLength = int64(len(masked))
+
+	dump, err := httputil.DumpRequestOut(redacted, true)
+	c.writeDump(dump, err)
+}
+
+func (c *defaultTransport) dumpResponse(resp *http.Response) {
+	redacted := *resp
+	redacted.Header = redactHeaders(resp.Header)
+
+	// Reading the body of an event stream would block until the subscription
+	// ends.
+	withBody := !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if withBody {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			c.writeDump(nil, err)
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+			return
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		masked := maskSecretFields(body)
+		redacted.Body = io.NopCloser(bytes.NewReader(masked))
+		if redacted.ContentLength >= 0 {
+			redacted.ContentLength = int64(len(masked))
+		}
+	}
+
+	dump, err := httputil.DumpResponse(&redacted, withBody)
+	c.writeDump(dump, err)
+}
+
+func (c *defaultTransport) writeDump(dump []byte, err error) {
+	c.dumpMutex.Lock()
+	defer c.dumpMutex.Unlock()
+
+	if err != nil {
+		fmt.Fprintf(c.dump, "failed to dump: %v\n\n", err)
+		return
+	}
+	c.dump.Write(dump)
+	c.dump.Write([]byte("\n\n"))
+}
+
+// cancelOnCloseBody releases a request's context once its body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// drainAndClose closes a response body whose content is of no interest. Unread
+// bodies prevent the connection from being reused and small remainders are
+// cheaper to drain than establishing a new connection.
+func drainAndClose(body io.ReadCloser) error {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainedBodySize))
+	return body.Close()
+}
+
+const maxDrainedBodySize = 64 << 10
+
+// Headers carrying credentials, which must not be dumped.
+var redactedHeaders = []string{"Authorization", "Refresh-Token", "CSRF-Token", "Cookie", "Set-Cookie"}
+
+// JSON fields carrying credentials, e.g. in login requests and responses,
+// which must not be dumped.
+var secretFields = []string{"password", "refresh_token", "auth_token", "csrf_token"}
+
+// redactHeaders returns a copy of header with the values of redactedHeaders
+// replaced.
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range redactedHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(key)]; ok {
+			redacted.Set(key, "<redacted>")
+		}
+	}
+	return redacted
+}
+
+// maskSecretFields replaces the values of secretFields in a JSON body. Bodies
+// that aren't JSON or don't contain any secrets are returned as is.
+func maskSecretFields(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil || !maskSecretValues(value) {
+		return body
+	}
+	var masked bytes.Buffer
+	encoder := json.NewEncoder(&masked)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(masked.Bytes(), []byte("\n"))
+}
+
+// maskSecretValues masks secretFields in place, recursively. Returns whether
+// anything was masked.
+func maskSecretValues(value any) bool {
+	masked := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if slices.Contains(secretFields, key) && field != nil {
+				v[key] = "<redacted>"
+				masked = true
+			} else if maskSecretValues(field) {
+				masked = true
+			}
+		}
+	case []any:
+		for _, element := range v {
+			if maskSecretValues(element) {
+				masked = true
+			}
+		}
+	}
+	return masked
+}
+
+// errReader returns err on every read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
 }
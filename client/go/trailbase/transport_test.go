@@ -0,0 +1,1221 @@
+package trailbase
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBasePathPrefix(t *testing.T) {
+	for _, prefix := range []string{"/trailbase", "/trailbase/"} {
+		var gotPath string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		}))
+		defer srv.Close()
+
+		client, err := NewClient(srv.URL + prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+		_, err = api.Read(StringRecordId("abc"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "/trailbase/api/records/v1/simple_strict_table/abc"
+		if gotPath != want {
+			t.Fatalf("got %q, want %q", gotPath, want)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	client, err := NewClient(srv.URL, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	_, err = api.Read(StringRecordId("abc"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded, got:", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatal("timeout took too long:", elapsed)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/records/v1/simple_strict_table/fast" {
+			w.Write([]byte(`{"id": "fast", "text_not_null": "test"}`))
+			return
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	// The per-call timeout takes precedence over the client's.
+	client, err := NewClient(srv.URL, WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	start := time.Now()
+	_, err = api.Read(StringRecordId("abc"), WithCallTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded, got:", err)
+	}
+	_, err = api.List(&ListArguments{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded, got:", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatal("timeout took too long:", elapsed)
+	}
+
+	if _, err := api.Read(StringRecordId("fast"), WithCallTimeout(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	_, err = api.Read(StringRecordId("abc"))
+
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) {
+		t.Fatal("expected RateLimitError, got:", err)
+	}
+	if rerr.RetryAfter != 5*time.Second {
+		t.Fatal("unexpected RetryAfter:", rerr.RetryAfter)
+	}
+
+	var ferr *FetchError
+	if !errors.As(err, &ferr) || ferr.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("expected FetchError, got:", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"invalid", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value, now); got != test.want {
+			t.Fatalf("parseRetryAfter(%q): got %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestQueryParamEncoding(t *testing.T) {
+	var gotQuery url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	value := "a=b?c&d%e+f [g] #h"
+	_, err = api.List(&ListArguments{
+		Filters: []Filter{
+			FilterColumn{Column: "col=&?", Op: Equal, Value: value},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gotQuery.Get("filter[col=&?][$eq]"); got != value {
+		t.Fatalf("got %q, want %q (query: %v)", got, value, gotQuery)
+	}
+
+	_, err = api.List(&ListArguments{
+		Filters: []Filter{
+			FilterColumn{Column: "col[0]", Value: value},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error for column name with brackets")
+	}
+}
+
+func TestRequestDump(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ids": ["response-id"]}`))
+	}))
+	defer srv.Close()
+
+	refreshToken := "secret-refresh"
+	csrfToken := "secret-csrf"
+	var dump bytes.Buffer
+	client, err := NewClientWithTokens(srv.URL, &Tokens{
+		AuthToken:    "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x","exp":9999999999}`)) + ".sig",
+		RefreshToken: &refreshToken,
+		CsrfToken:    &csrfToken,
+	}, WithRequestDump(&dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	if _, err := api.Create(SimpleStrict{TextNotNull: "request-body"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := dump.String()
+	for _, want := range []string{"POST /api/records/v1/simple_strict_table", "request-body", "200 OK", "response-id", "<redacted>"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in dump:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"header.", refreshToken, csrfToken} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("unexpected %q in dump:\n%s", secret, got)
+		}
+	}
+}
+
+func TestRequestDumpLogin(t *testing.T) {
+	authToken := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x","exp":9999999999}`)) + ".sig"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "auth_token", Value: "secret-cookie"})
+		fmt.Fprintf(w, `{"auth_token": %q, "refresh_token": "secret-refresh", "csrf_token": "secret-csrf"}`, authToken)
+	}))
+	defer srv.Close()
+
+	var dump bytes.Buffer
+	client, err := NewClient(srv.URL, WithRequestDump(&dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Login("user@example.com", "secret-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client still sees the unmasked response.
+	tokens := client.Tokens()
+	if tokens == nil || tokens.AuthToken != authToken || *tokens.RefreshToken != "secret-refresh" {
+		t.Fatal("unexpected tokens:", tokens)
+	}
+
+	got := dump.String()
+	for _, want := range []string{"POST /api/auth/v1/login", "user@example.com", `"password":"<redacted>"`, `"auth_token":"<redacted>"`, "Set-Cookie: <redacted>"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in dump:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"header.", "secret-password", "secret-refresh", "secret-csrf", "secret-cookie"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("unexpected %q in dump:\n%s", secret, got)
+		}
+	}
+}
+
+type observedRequest struct {
+	method string
+	path   string
+	status int
+}
+
+// recordingObserver is an example MetricsObserver. A real one would, e.g.,
+// increment a Prometheus counter and observe the duration in a histogram.
+type recordingObserver struct {
+	requests []observedRequest
+}
+
+func (o *recordingObserver) ObserveRequest(method string, path string, status int, dur time.Duration) {
+	o.requests = append(o.requests, observedRequest{method: method, path: path, status: status})
+}
+
+func TestMetricsObserver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer srv.Close()
+
+	observer := &recordingObserver{}
+	client, err := NewClient(srv.URL, WithMetrics(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	if _, err := api.Read(StringRecordId("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Delete(StringRecordId("abc")); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := []observedRequest{
+		{method: "GET", path: "api/records/v1/simple_strict_table/abc", status: 200},
+		{method: "DELETE", path: "api/records/v1/simple_strict_table/abc", status: 403},
+	}
+	if !testEq(observer.requests, expected) {
+		t.Fatalf("got %v, want %v", observer.requests, expected)
+	}
+}
+
+func TestConnectionPoolOptions(t *testing.T) {
+	options := clientOptions{}
+	WithMaxIdleConnsPerHost(64)(&options)
+	WithMaxConnsPerHost(128)(&options)
+
+	transport := options.buildHttpClient().Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 64 || transport.MaxConnsPerHost != 128 {
+		t.Fatalf("unexpected transport settings: %d, %d", transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+	if transport == http.DefaultTransport {
+		t.Fatal("must not modify the default transport")
+	}
+
+	WithMaxIdleConns(16)(&options)
+	WithIdleConnTimeout(5 * time.Minute)(&options)
+	transport = options.buildHttpClient().Transport.(*http.Transport)
+	if transport.MaxIdleConns != 16 || transport.IdleConnTimeout != 5*time.Minute {
+		t.Fatalf("unexpected transport settings: %d, %s", transport.MaxIdleConns, transport.IdleConnTimeout)
+	}
+
+	// Custom clients take precedence.
+	custom := &http.Client{}
+	WithHTTPClient(custom)(&options)
+	if options.buildHttpClient() != custom {
+		t.Fatal("expected custom client")
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Ok"))
+	}))
+	defer srv.Close()
+
+	// The server's self-signed certificate isn't trusted by default.
+	client, err := NewClient(srv.URL)
+	assertFine(t, err)
+	assert(t, client.Ping() != nil, "expected certificate error")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client, err = NewClient(srv.URL, WithRootCAs(pool))
+	assertFine(t, err)
+	assertFine(t, client.Ping())
+
+	client, err = NewClient(srv.URL, WithInsecureSkipVerify())
+	assertFine(t, err)
+	assertFine(t, client.Ping())
+
+	_, err = NewClient(srv.URL, WithRootCAs(pool), WithHTTPClient(srv.Client()))
+	assert(t, err != nil, "expected error combining TLS options and custom client")
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	var connections atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch connections.Add(1) {
+		case 1:
+			// Drop the connection after the first event.
+			w.Write([]byte("data: {\"Insert\": {\"id\": 1}, \"seq\": 0}\n\n"))
+		case 2:
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+		case 3:
+			w.Write([]byte("data: {\"Insert\": {\"id\": 2}, \"seq\": 0}\n\n"))
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL)
+	assertFine(t, err)
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+
+	events, cancel, err := api.SubscribeAll(WithReconnect(10 * time.Millisecond))
+	assertFine(t, err)
+	defer cancel()
+
+	ids := []string{}
+	for event := range events {
+		ids = append(ids, fmt.Sprint((*event.Value.Value())["id"]))
+	}
+	// The channel is only closed once reconnecting fails permanently.
+	assertEqual(t, "1,2", strings.Join(ids, ","))
+	assertEqual(t, int32(4), connections.Load())
+
+	// Without the option, the channel is closed when the connection drops.
+	connections.Store(0)
+	events, cancel, err = api.SubscribeAll()
+	assertFine(t, err)
+	defer cancel()
+	for range events {
+	}
+	assertEqual(t, int32(1), connections.Load())
+}
+
+func TestClockSkew(t *testing.T) {
+	client, err := NewClientWithTokens("http://127.0.0.1:1", newTestTokens(time.Now().Add(30*time.Minute)), WithRefreshLeeway(0))
+	assertFine(t, err)
+
+	_, refreshToken := client.getHeadersAndRefreshTokenIfExpired()
+	assert(t, refreshToken == nil, "unexpected refresh before learning skew")
+
+	// Server clock is an hour ahead of ours. The token is valid for 30 more
+	// minutes by our clock, but already expired by the server's.
+	client.updateClockOffset(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Now())
+	_, refreshToken = client.getHeadersAndRefreshTokenIfExpired()
+	assert(t, refreshToken != nil, "expected refresh after learning skew")
+
+	// Sub-second differences are within Date's resolution and ignored.
+	client.updateClockOffset(time.Now().UTC().Format(http.TimeFormat), time.Now())
+	assertEqual(t, 0, client.clockOffset.Load())
+}
+
+func TestClockSkewFromResponse(t *testing.T) {
+	// Server clock is an hour behind ours.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithRefreshLeeway(0))
+	assertFine(t, err)
+
+	resp, err := client.do("GET", "api/test", nil, nil)
+	assertFine(t, err)
+	resp.Body.Close()
+
+	offset := time.Duration(client.clockOffset.Load())
+	assert(t, offset < -59*time.Minute && offset > -61*time.Minute, fmt.Sprint("unexpected offset: ", offset))
+
+	// Expired by our clock, but valid for another 30 minutes by the server's.
+	client.tokenState, err = NewTokenState(newTestTokens(time.Now().Add(-30 * time.Minute)))
+	assertFine(t, err)
+	_, refreshToken := client.getHeadersAndRefreshTokenIfExpired()
+	assert(t, refreshToken == nil, "unexpected refresh of token valid by server clock")
+}
+
+func TestLogoutAll(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		w.Write([]byte("logged out"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+	assert(t, client.LogoutAll() != nil, "expected error when unauthenticated")
+	assertEqual(t, "", gotPath)
+
+	tokens := newTestTokens(time.Now().Add(time.Hour))
+	client, err = NewClientWithTokens(server.URL, tokens)
+	assertFine(t, err)
+	assertFine(t, client.LogoutAll())
+
+	assertEqual(t, "GET", gotMethod)
+	assertEqual(t, "/api/auth/v1/logout", gotPath)
+	assertEqual(t, "Bearer "+tokens.AuthToken, gotAuth)
+	assert(t, client.Tokens() == nil, "expected tokens to be cleared")
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	authToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+
+	for _, rotated := range []string{"", "rotated"} {
+		var gotRefreshToken string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			assertFine(t, json.NewDecoder(r.Body).Decode(&req))
+			gotRefreshToken = req.RefreshToken
+
+			resp := map[string]any{"auth_token": authToken}
+			if rotated != "" {
+				resp["refresh_token"] = rotated
+			}
+			assertFine(t, json.NewEncoder(w).Encode(resp))
+		}))
+
+		base, err := url.Parse(server.URL)
+		assertFine(t, err)
+		transport := &defaultTransport{base: base, client: &http.Client{}}
+
+		state, err := doRefreshToken(context.Background(), transport, authApi, nil, "old")
+		server.Close()
+		assertFine(t, err)
+		assertEqual(t, "old", gotRefreshToken)
+
+		want := "old"
+		if rotated != "" {
+			want = rotated
+		}
+		assertEqual(t, want, *state.s.tokens.RefreshToken)
+		assertEqual(t, authToken, state.s.tokens.AuthToken)
+	}
+}
+
+func TestRefreshError(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path == "/api/auth/v1/refresh" {
+			http.Error(w, "revoked", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Expired auth token triggers a refresh before the actual request.
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(-time.Minute)))
+	assertFine(t, err)
+
+	_, err = client.do("GET", "api/test", nil, nil)
+	var refreshErr *RefreshError
+	assert(t, errors.As(err, &refreshErr), fmt.Sprint("expected RefreshError, got: ", err))
+	assert(t, refreshErr.SessionEnded, "expected session to have ended")
+	var ferr *FetchError
+	assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusUnauthorized, "expected wrapped FetchError")
+	assert(t, client.Tokens() == nil, "expected logout")
+
+	// Subsequent requests go out unauthenticated rather than retrying the refresh.
+	resp, err := client.do("GET", "api/test", nil, nil)
+	assertFine(t, err)
+	resp.Body.Close()
+	assertEqual(t, 2, len(requests))
+	assertEqual(t, "/api/test", requests[1])
+}
+
+func TestRefreshErrorTransient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(-time.Minute)))
+	assertFine(t, err)
+
+	err = client.Refresh()
+	var refreshErr *RefreshError
+	assert(t, errors.As(err, &refreshErr) && !refreshErr.SessionEnded, fmt.Sprint("expected transient RefreshError, got: ", err))
+	assert(t, client.Tokens() != nil, "expected tokens to be kept")
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	freshTokens := newTestTokens(time.Now().Add(2 * time.Hour))
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/auth/v1/refresh":
+			assertFine(t, json.NewEncoder(w).Encode(map[string]any{"auth_token": freshTokens.AuthToken}))
+		case "/api/records/v1/simple_strict_table/abc":
+			// Reject the still unexpired but revoked initial token.
+			if r.Header.Get("Authorization") != "Bearer "+freshTokens.AuthToken {
+				http.Error(w, "revoked", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		case "/api/auth/v1/login":
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(time.Hour)))
+	assertFine(t, err)
+
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	record, err := api.Read(StringRecordId("abc"))
+	assertFine(t, err)
+	assertEqual(t, "test", record.TextNotNull)
+	assertEqual(t, freshTokens.AuthToken, client.Tokens().AuthToken)
+	assertEqual(t, 3, len(requests))
+	assertEqual(t, "/api/auth/v1/refresh", requests[1])
+
+	// Failed logins don't trigger a refresh.
+	_, err = client.Login("user@test.org", "wrong")
+	var ferr *FetchError
+	assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusUnauthorized, fmt.Sprint("expected 401, got: ", err))
+	assertEqual(t, 4, len(requests))
+}
+
+func TestApiPathOverrides(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/auth/v2/login":
+			assertFine(t, json.NewEncoder(w).Encode(newTestTokens(time.Now().Add(time.Hour))))
+		case "/api/transaction/v2/execute":
+			w.Write([]byte(`{"results": [{}]}`))
+		default:
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithAuthApiPath("/api/auth/v2/"), WithRecordApiPath("api/records/v2"), WithTransactionApiPath("api/transaction/v2"))
+	assertFine(t, err)
+
+	_, err = client.Login("user@test.org", "secret")
+	assertFine(t, err)
+	_, err = NewRecordApi[SimpleStrict](client, "simple_strict_table").Read(StringRecordId("abc"))
+	assertFine(t, err)
+	batch := client.Transaction()
+	batch.Api("simple_strict_table").Delete(StringRecordId("abc"))
+	_, err = batch.Send()
+	assertFine(t, err)
+
+	assertEqual(t, "/api/auth/v2/login,/api/records/v2/simple_strict_table/abc,/api/transaction/v2/execute", strings.Join(paths, ","))
+}
+
+func TestCallRoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/custom/echo" || r.Header.Get("Authorization") == "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithTokens(server.URL, newTestTokens(time.Now().Add(time.Hour)))
+	assertFine(t, err)
+
+	type Message struct {
+		Text string `json:"text"`
+	}
+	var out Message
+	assertFine(t, client.Call(t.Context(), "POST", "api/custom/echo", Message{Text: "hello"}, &out))
+	assertEqual(t, "hello", out.Text)
+
+	err = client.Call(t.Context(), "POST", "api/custom/unknown", nil, nil)
+	var ferr *FetchError
+	assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusBadRequest, fmt.Sprint("expected 400, got: ", err))
+}
+
+func TestClientURL(t *testing.T) {
+	for _, base := range []string{"https://example.com/trailbase", "https://example.com/trailbase/"} {
+		client, err := NewClient(base)
+		assertFine(t, err)
+
+		assertEqual(t, "https://example.com/trailbase/api/custom/endpoint", client.URL("api", "custom/endpoint").String())
+		assertEqual(t, "https://example.com/trailbase/api/healthcheck", client.URL(healthcheckApi).String())
+		assertEqual(t, "https://example.com/trailbase", strings.TrimSuffix(client.URL().String(), "/"))
+	}
+}
+
+func TestCsrfTokenAfterRefresh(t *testing.T) {
+	freshAuthToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+
+	csrfTokens := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/v1/refresh" {
+			w.Write(fmt.Appendf(nil, `{"auth_token": %q, "csrf_token": "fresh"}`, freshAuthToken))
+			return
+		}
+		csrfTokens[r.Method+" "+r.URL.Path] = r.Header.Get("CSRF-Token")
+		switch r.Method {
+		case "POST":
+			w.Write([]byte(`{"ids": ["1"]}`))
+		case "PATCH", "DELETE":
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	newClient := func(exp time.Time) *Client {
+		tokens := newTestTokens(exp)
+		stale := "stale"
+		tokens.CsrfToken = &stale
+		client, err := NewClientWithTokens(server.URL, tokens)
+		assertFine(t, err)
+		return client
+	}
+
+	// Explicit refresh.
+	client := newClient(time.Now().Add(time.Hour))
+	assertFine(t, client.Refresh())
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	_, err := api.Create(SimpleStrict{TextNotNull: "test"})
+	assertFine(t, err)
+	assertEqual(t, "fresh", csrfTokens["POST /api/records/v1/simple_strict_table"])
+
+	// Proactive refresh as part of state-changing requests.
+	for _, op := range []func(api *RecordApi[SimpleStrict]) (string, error){
+		func(api *RecordApi[SimpleStrict]) (string, error) {
+			return "PATCH /api/records/v1/simple_strict_table/1", api.Update(StringRecordId("1"), SimpleStrict{})
+		},
+		func(api *RecordApi[SimpleStrict]) (string, error) {
+			return "DELETE /api/records/v1/simple_strict_table/1", api.Delete(StringRecordId("1"))
+		},
+	} {
+		client := newClient(time.Now().Add(-time.Minute))
+		key, err := op(NewRecordApi[SimpleStrict](client, "simple_strict_table"))
+		assertFine(t, err)
+		assertEqual(t, "fresh", csrfTokens[key])
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotAuth, gotBody = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), string(body)
+		if r.URL.Path == "/api/missing" {
+			http.Error(w, "missing", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tokens := newTestTokens(time.Now().Add(time.Hour))
+	client, err := NewClientWithTokens(server.URL, tokens)
+	assertFine(t, err)
+
+	resp, err := client.Do(context.Background(), "POST", "api/custom", []byte(`{"a":1}`), []QueryParam{NewQueryParam("q", "a b")})
+	assertFine(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assertFine(t, err)
+	resp.Body.Close()
+
+	assertEqual(t, "ok", string(body))
+	assertEqual(t, "/api/custom", gotPath)
+	assertEqual(t, "q=a+b", gotQuery)
+	assertEqual(t, "Bearer "+tokens.AuthToken, gotAuth)
+	assertEqual(t, `{"a":1}`, gotBody)
+
+	_, err = client.Do(context.Background(), "GET", "api/missing", nil, nil)
+	var ferr *FetchError
+	assert(t, errors.As(err, &ferr) && ferr.StatusCode == http.StatusNotFound, fmt.Sprint("expected 404, got ", err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Do(ctx, "GET", "api/custom", nil, nil)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprint("expected cancellation, got ", err))
+}
+
+func TestClone(t *testing.T) {
+	parent, err := NewClientWithTokens("http://127.0.0.1:1", newTestTokens(time.Now().Add(time.Hour)), WithTimeout(time.Second))
+	assertFine(t, err)
+
+	clone := parent.Clone()
+	assert(t, clone.Tokens() == nil, "expected unauthenticated clone")
+	assert(t, clone.client == parent.client, "expected shared transport")
+	assertEqual(t, parent.timeout, clone.timeout)
+	assert(t, clone.tokenMutex != parent.tokenMutex, "expected separate mutex")
+
+	otherTokens := newTestTokens(time.Now().Add(2 * time.Hour))
+	authed, err := parent.CloneWithTokens(otherTokens)
+	assertFine(t, err)
+	assertEqual(t, otherTokens.AuthToken, authed.Tokens().AuthToken)
+
+	// Token changes don't leak between parent and clones.
+	_, err = authed.updateTokens(nil)
+	assertFine(t, err)
+	assert(t, parent.Tokens() != nil, "expected parent to stay authenticated")
+
+	_, err = parent.updateTokens(nil)
+	assertFine(t, err)
+	_, err = clone.updateTokens(otherTokens)
+	assertFine(t, err)
+	assert(t, parent.Tokens() == nil, "expected parent to stay logged out")
+	assert(t, clone.Tokens() != nil, "expected clone to be authenticated")
+
+	_, err = parent.CloneWithTokens(&Tokens{AuthToken: "invalid"})
+	assert(t, err != nil, "expected error for invalid tokens")
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	var dump bytes.Buffer
+	parent, err := NewClient(srv.URL, WithRequestDump(&dump))
+	assertFine(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		tokens := newTestTokens(time.Now().Add(time.Hour + time.Duration(i)*time.Second))
+		clone, err := parent.CloneWithTokens(tokens)
+		assertFine(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				resp, err := clone.Do(t.Context(), "GET", "api/whoami", nil, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				got, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(got) != "Bearer "+tokens.AuthToken {
+					errs <- fmt.Errorf("request %d authenticated as another clone", i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	assert(t, parent.Tokens() == nil, "expected parent to stay unauthenticated")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// refreshTransport answers refresh requests using respond and all other
+// requests with an empty 200.
+type refreshTransport struct {
+	base    *url.URL
+	respond func() *http.Response
+}
+
+func (t *refreshTransport) BaseUrl() *url.URL {
+	return t.base
+}
+
+func (t *refreshTransport) Get(u string) (*http.Response, error) {
+	return nil, errors.New("unexpected Get")
+}
+
+func (t *refreshTransport) Do(ctx context.Context, method string, path string, headers []Header, body []byte, queryParams []QueryParam) (*http.Response, error) {
+	if path == authApi+"/refresh" {
+		return t.respond(), nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestRefreshBodyReadError(t *testing.T) {
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &refreshTransport{base: base, respond: func() *http.Response {
+		// Server accepted the refresh but the connection dropped mid-body.
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(failingReader{})}
+	}}
+
+	for _, exp := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(-time.Minute)} {
+		tokens := newTestTokens(exp)
+		client, err := NewClientWithTokens(base.String(), tokens, WithTransport(transport))
+		assertFine(t, err)
+
+		if exp.After(time.Now()) {
+			err = client.Refresh()
+		} else {
+			_, err = client.do("GET", "api/test", nil, nil)
+		}
+		var refreshErr *RefreshError
+		assert(t, errors.As(err, &refreshErr) && !refreshErr.SessionEnded, fmt.Sprint("expected transient RefreshError, got: ", err))
+
+		// Previous state is retained untouched.
+		got := client.Tokens()
+		assert(t, got != nil, "expected tokens to be kept")
+		assertEqual(t, tokens.AuthToken, got.AuthToken)
+		assertEqual(t, *tokens.RefreshToken, *got.RefreshToken)
+	}
+}
+
+func TestRefreshConcurrentLogout(t *testing.T) {
+	base, _ := url.Parse("http://trailbase.test")
+	freshAuthToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+
+	var client *Client
+	transport := &refreshTransport{base: base, respond: func() *http.Response {
+		// Logout races with the in-flight refresh.
+		_, err := client.updateTokens(nil)
+		assertFine(t, err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(fmt.Sprintf(`{"auth_token": %q, "csrf_token": "csrf"}`, freshAuthToken))),
+		}
+	}}
+
+	client, err := NewClientWithTokens(base.String(), newTestTokens(time.Now().Add(time.Hour)), WithTransport(transport))
+	assertFine(t, err)
+
+	assertFine(t, client.Refresh())
+	assert(t, client.Tokens() == nil, "refresh must not undo logout")
+}
+
+// newLoginServer returns a server answering logins, which counts the number of
+// connections opened to it.
+func newLoginServer(tb testing.TB) (*httptest.Server, *atomic.Int64) {
+	authToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, `{"auth_token": %q, "refresh_token": "refresh", "csrf_token": "csrf"}`, authToken)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server, &conns
+}
+
+func TestLoginConnectionReuse(t *testing.T) {
+	server, conns := newLoginServer(t)
+
+	client, err := NewClient(server.URL)
+	assertFine(t, err)
+	for range 10 {
+		_, err := client.Login("user", "secret")
+		assertFine(t, err)
+		// Exercise other endpoints, which must release their connection too.
+		assertFine(t, client.RequestOtp("user"))
+		assertFine(t, client.Logout())
+	}
+	assertEqual(t, int64(1), conns.Load())
+}
+
+func BenchmarkLogin(b *testing.B) {
+	server, conns := newLoginServer(b)
+
+	client, err := NewClient(server.URL, WithIdleConnTimeout(time.Minute))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := client.Login("user", "secret"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(conns.Load()), "conns")
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	authToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+
+	var mutex sync.Mutex
+	seen := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		seen[r.URL.Path] = r.Header.Clone()
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/api/auth/v1/login":
+			fmt.Fprintf(w, `{"auth_token": %q, "refresh_token": "refresh", "csrf_token": "csrf"}`, authToken)
+		default:
+			w.Write([]byte(`{"text_not_null": "test"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithDefaultHeaders(
+		NewHeader("X-Tenant-ID", "tenant"),
+		NewHeader("Content-Type", "text/plain"),
+		NewHeader("Authorization", "Bearer forged"),
+	))
+	assertFine(t, err)
+
+	_, err = client.Login("user", "secret")
+	assertFine(t, err)
+	_, err = NewRecordApi[SimpleStrict](client, "simple_strict_table").Read(StringRecordId("id"))
+	assertFine(t, err)
+
+	for _, path := range []string{"/api/auth/v1/login", "/api/records/v1/simple_strict_table/id"} {
+		headers, ok := seen[path]
+		assert(t, ok, "missing request to "+path)
+		assertEqual(t, "tenant", headers.Get("X-Tenant-ID"))
+		assertEqual(t, "application/json", headers.Get("Content-Type"))
+	}
+	assertEqual(t, "Bearer "+authToken, seen["/api/records/v1/simple_strict_table/id"].Get("Authorization"))
+}
+
+func TestServiceToken(t *testing.T) {
+	// Already expired, which would ordinarily trigger a refresh.
+	authToken := newTestTokens(time.Now().Add(-time.Hour)).AuthToken
+
+	var refreshes atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/v1/refresh" {
+			refreshes.Add(1)
+		}
+		assertEqual(t, "Bearer "+authToken, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithServiceToken(server.URL, authToken)
+	assertFine(t, err)
+
+	api := NewRecordApi[SimpleStrict](client, "simple_strict_table")
+	for range 3 {
+		_, err := api.Read(StringRecordId("id"))
+		assertFine(t, err)
+	}
+	assertEqual(t, int64(0), refreshes.Load())
+}
+
+func TestDebugLogger(t *testing.T) {
+	tokens := newTestTokens(time.Now().Add(time.Hour))
+	refreshToken := "secret-refresh-token"
+	tokens.RefreshToken = &refreshToken
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"text_not_null": "test"}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewClientWithTokens(server.URL, tokens, WithDebugLogger(logger))
+	assertFine(t, err)
+
+	_, err = NewRecordApi[SimpleStrict](client, "simple_strict_table").Read(StringRecordId("id"))
+	assertFine(t, err)
+
+	out := buf.String()
+	for _, expected := range []string{"method=GET", "/api/records/v1/simple_strict_table/id", "status=200", "headers.Authorization=<redacted>", "headers.Refresh-Token=<redacted>", "body_size=0"} {
+		assert(t, strings.Contains(out, expected), fmt.Sprintf("expected %q in %q", expected, out))
+	}
+	assert(t, !strings.Contains(out, tokens.AuthToken), "auth token leaked: "+out)
+	assert(t, !strings.Contains(out, *tokens.RefreshToken), "refresh token leaked: "+out)
+}
+
+func TestBackgroundRefresh(t *testing.T) {
+	freshToken := newTestTokens(time.Now().Add(time.Hour)).AuthToken
+	var refreshes atomic.Int64
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &refreshTransport{base: base, respond: func() *http.Response {
+		refreshes.Add(1)
+		body := fmt.Sprintf(`{"auth_token": %q}`, freshToken)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+	}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	// Within the refresh leeway, i.e. due right away.
+	client, err := NewClientWithTokens(base.String(), newTestTokens(time.Now().Add(10*time.Second)), WithTransport(transport), WithBackgroundRefresh(ctx))
+	assertFine(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for refreshes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertEqual(t, int64(1), refreshes.Load())
+	assertEqual(t, freshToken, client.Tokens().AuthToken)
+
+	// The fresh token isn't due, neither for a background nor a lazy refresh.
+	_, err = client.do("GET", "api/test", nil, nil)
+	assertFine(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(t, int64(1), refreshes.Load())
+
+	// Logged out clients idle until logged in again.
+	assertFine(t, client.Logout())
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(t, int64(1), refreshes.Load())
+
+	tokens := newTestTokens(time.Now().Add(10 * time.Second))
+	newSession := "new-session"
+	tokens.RefreshToken = &newSession
+	_, err = client.updateTokens(tokens)
+	assertFine(t, err)
+	deadline = time.Now().Add(5 * time.Second)
+	for refreshes.Load() == 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertEqual(t, int64(2), refreshes.Load())
+}
+
+func TestBackgroundRefreshRotatedDueTokens(t *testing.T) {
+	var refreshes atomic.Int64
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &refreshTransport{base: base, respond: func() *http.Response {
+		refreshes.Add(1)
+		// Rotated, but still due right away.
+		body := fmt.Sprintf(`{"auth_token": %q, "refresh_token": "rotated-%d"}`, newTestTokens(time.Now()).AuthToken, refreshes.Load())
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+	}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	_, err := NewClientWithTokens(base.String(), newTestTokens(time.Now()), WithTransport(transport), WithBackgroundRefresh(ctx))
+	assertFine(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for refreshes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The rotated token is throttled like a retry rather than treated as a
+	// new session.
+	time.Sleep(100 * time.Millisecond)
+	assertEqual(t, int64(1), refreshes.Load())
+}
+
+type closeTrackingTransport struct {
+	refreshTransport
+	closedIdle atomic.Int64
+}
+
+func (t *closeTrackingTransport) CloseIdleConnections() {
+	t.closedIdle.Add(1)
+}
+
+func TestClientClose(t *testing.T) {
+	var refreshes atomic.Int64
+	base, _ := url.Parse("http://trailbase.test")
+	transport := &closeTrackingTransport{refreshTransport: refreshTransport{base: base, respond: func() *http.Response {
+		refreshes.Add(1)
+		// Still due, such that only closing stops subsequent background refreshes.
+		body := fmt.Sprintf(`{"auth_token": %q, "refresh_token": "rotated-%d"}`, newTestTokens(time.Now()).AuthToken, refreshes.Load())
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+	}}}
+
+	client, err := NewClientWithTokens(base.String(), newTestTokens(time.Now()), WithTransport(transport), WithBackgroundRefresh(t.Context()))
+	assertFine(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for refreshes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assertFine(t, client.Close())
+	// User-supplied transports may be shared and are left alone.
+	assertEqual(t, int64(0), transport.closedIdle.Load())
+
+	// Rotated but immediately due tokens don't cause a refresh loop.
+	assertEqual(t, int64(1), refreshes.Load())
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(t, int64(1), refreshes.Load())
+
+	_, err = client.do("GET", "api/test", nil, nil)
+	assert(t, errors.Is(err, ErrClientClosed), fmt.Sprint("expected ErrClientClosed, got: ", err))
+	assert(t, errors.Is(client.Refresh(), ErrClientClosed), "expected ErrClientClosed from Refresh")
+	assert(t, errors.Is(client.Ping(), ErrClientClosed), "expected ErrClientClosed from Ping")
+
+	// Closing is idempotent and clones are independent.
+	assertFine(t, client.Close())
+	_, err = client.Clone().do("GET", "api/test", nil, nil)
+	assertFine(t, err)
+}
+
+func TestClientCloseOwnedConnections(t *testing.T) {
+	closedConns := make(chan struct{}, 16)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closedConns <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	request := func(client *Client) {
+		t.Helper()
+		resp, err := client.Do(t.Context(), "GET", "api/test", nil, nil)
+		assertFine(t, err)
+		assertFine(t, drainAndClose(resp.Body))
+	}
+
+	// Clones don't own their parent's pool.
+	parent, err := NewClient(srv.URL, WithMaxIdleConns(4))
+	assertFine(t, err)
+	clone := parent.Clone()
+	request(clone)
+	assertFine(t, clone.Close())
+	select {
+	case <-closedConns:
+		t.Fatal("clone closed its parent's connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assertFine(t, parent.Close())
+	select {
+	case <-closedConns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected idle connection to be closed")
+	}
+}
@@ -51,7 +51,7 @@ impl CompareOp {
       Self::LessThan => format!("{column} < {param}"),
       Self::NotEqual => format!("{column} <> {param}"),
       Self::Is => format!("{column} IS {param}"),
-      Self::Like => format!("{column} LIKE {param}"),
+      Self::Like => format!("{column} LIKE {param} ESCAPE '\\'"),
       Self::Regexp => format!("{column} REGEXP {param}"),
       Self::Equal => format!("{column} = {param}"),
       // Spatial Types:
@@ -187,3 +187,39 @@ where
 }
 
 const OP_ERR: &str = "one of [$eq, $ne, $lt, ...]";
+
+#[cfg(test)]
+mod tests {
+  use super::*;
+
+  #[test]
+  fn test_like_escape() {
+    assert_eq!(
+      CompareOp::Like.as_sql(r#""col""#, ":p"),
+      r#""col" LIKE :p ESCAPE '\'"#
+    );
+
+    let conn = rusqlite::Connection::open_in_memory().unwrap();
+    let like = |value: &str, pattern: &str| -> bool {
+      let sql = format!("SELECT {}", CompareOp::Like.as_sql(":v", ":p"));
+      return conn
+        .query_row(
+          &sql,
+          rusqlite::named_params! {":v": value, ":p": pattern},
+          |row| row.get(0),
+        )
+        .unwrap();
+    };
+
+    // Unescaped wildcards keep their meaning.
+    assert!(like("50 percent", "50%"));
+    assert!(like("a-b", "a_b"));
+
+    // Escaped meta-characters match literally.
+    assert!(like("50%", r"50\%"));
+    assert!(!like("50 percent", r"50\%"));
+    assert!(like("a_b", r"a\_b"));
+    assert!(!like("a-b", r"a\_b"));
+    assert!(like(r"C:\dir", r"C:\\dir"));
+  }
+}
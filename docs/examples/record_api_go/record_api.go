@@ -1,7 +1,7 @@
 package record_api_docs
 
 type Movie struct {
-	name string `json:"name"`
+	Name string `json:"name"`
 }
 
 type SimpleStrict struct {